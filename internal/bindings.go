@@ -0,0 +1,231 @@
+package vre
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Action is what a key does in the terminal
+type Action int
+
+const (
+	ActNone Action = iota
+	ActIgnore
+	ActAbort
+	ActAccept
+	ActCancel
+	ActDown
+	ActUp
+	ActPageDown
+	ActPageUp
+	ActScrollLeft
+	ActScrollRight
+	ActToggleHidden
+	ActToggleMark
+	ActToggleCase
+	ActToggleInvert
+	ActOpenEditor
+	ActHistoryPrev
+	ActHistoryNext
+	ActHistorySearch
+	ActBackwardChar
+	ActForwardChar
+	ActBeginningOfLine
+	ActEndOfLine
+	ActBackwardWord
+	ActForwardWord
+	ActDeleteChar
+	ActBackwardDeleteChar
+	ActBackwardKillWord
+	ActKillWord
+	ActUnixWordRubout
+	ActUnixLineDiscard
+	ActKillLine
+	ActYank
+	ActAddPattern
+	ActToggleStats
+	ActToggleFold
+	ActToggleSummary
+	ActToggleTail
+	ActToggleLongLines
+	ActToggleWrap
+	ActNextMatch
+	ActPrevMatch
+	ActFirst
+	ActLast
+	ActGoTo
+	ActTogglePreview
+	ActPreviewUp
+	ActPreviewDown
+)
+
+var actionNames = map[string]Action{
+	"ignore":               ActIgnore,
+	"abort":                ActAbort,
+	"accept":               ActAccept,
+	"cancel":               ActCancel,
+	"down":                 ActDown,
+	"up":                   ActUp,
+	"page-down":            ActPageDown,
+	"page-up":              ActPageUp,
+	"scroll-left":          ActScrollLeft,
+	"scroll-right":         ActScrollRight,
+	"toggle-hidden":        ActToggleHidden,
+	"toggle-mark":          ActToggleMark,
+	"toggle-case":          ActToggleCase,
+	"toggle-invert":        ActToggleInvert,
+	"open-editor":          ActOpenEditor,
+	"history-prev":         ActHistoryPrev,
+	"history-next":         ActHistoryNext,
+	"history-search":       ActHistorySearch,
+	"backward-char":        ActBackwardChar,
+	"forward-char":         ActForwardChar,
+	"beginning-of-line":    ActBeginningOfLine,
+	"end-of-line":          ActEndOfLine,
+	"backward-word":        ActBackwardWord,
+	"forward-word":         ActForwardWord,
+	"delete-char":          ActDeleteChar,
+	"backward-delete-char": ActBackwardDeleteChar,
+	"backward-kill-word":   ActBackwardKillWord,
+	"kill-word":            ActKillWord,
+	"unix-word-rubout":     ActUnixWordRubout,
+	"unix-line-discard":    ActUnixLineDiscard,
+	"kill-line":            ActKillLine,
+	"yank":                 ActYank,
+	"add-pattern":          ActAddPattern,
+	"toggle-stats":         ActToggleStats,
+	"toggle-fold":          ActToggleFold,
+	"toggle-summary":       ActToggleSummary,
+	"toggle-tail":          ActToggleTail,
+	"toggle-long-lines":    ActToggleLongLines,
+	"toggle-wrap":          ActToggleWrap,
+	"next-match":           ActNextMatch,
+	"prev-match":           ActPrevMatch,
+	"first":                ActFirst,
+	"last":                 ActLast,
+	"go-to":                ActGoTo,
+	"toggle-preview":       ActTogglePreview,
+	"preview-up":           ActPreviewUp,
+	"preview-down":         ActPreviewDown,
+}
+
+var keyNames = map[string]int{
+	"enter":     KEY_ENTER,
+	"tab":       KEY_TAB,
+	"esc":       KEY_ESC,
+	"space":     ' ',
+	"comma":     ',',
+	"colon":     ':',
+	"bspace":    KEY_BACKSPACE,
+	"backspace": KEY_BACKSPACE,
+	"del":       KEY_DEL,
+	"up":        KEY_UP,
+	"down":      KEY_DOWN,
+	"left":      KEY_LEFT,
+	"right":     KEY_RIGHT,
+	"home":      KEY_HOME,
+	"end":       KEY_END,
+	"pgup":      KEY_PGUP,
+	"pgdn":      KEY_PGDN,
+}
+
+// Bindings maps keys to actions
+type Bindings map[int]Action
+
+// DefaultBindings returns the default key bindings
+func DefaultBindings() Bindings {
+	b := Bindings{}
+
+	// these are all valid so errors are impossible
+	ParseBindings("ctrl-c:abort,ctrl-d:abort,enter:accept,ctrl-g:cancel,"+
+		"ctrl-j:down,ctrl-k:up,ctrl-f:page-down,pgdn:page-down,ctrl-b:page-up,pgup:page-up,"+
+		"ctrl-h:scroll-left,ctrl-l:scroll-right,ctrl-t:toggle-hidden,tab:toggle-mark,"+
+		"alt-c:toggle-case,alt-v:toggle-invert,ctrl-o:open-editor,"+
+		"up:history-prev,down:history-next,ctrl-r:history-search,"+
+		"left:backward-char,right:forward-char,"+
+		"ctrl-a:beginning-of-line,home:beginning-of-line,ctrl-e:end-of-line,end:end-of-line,"+
+		"alt-b:backward-word,alt-left:backward-word,ctrl-left:backward-word,"+
+		"alt-f:forward-word,alt-right:forward-word,ctrl-right:forward-word,"+
+		"del:delete-char,bspace:backward-delete-char,alt-bspace:backward-kill-word,alt-d:kill-word,"+
+		"ctrl-w:unix-word-rubout,ctrl-u:unix-line-discard,ctrl-y:yank,alt-a:add-pattern,alt-s:toggle-stats,alt-enter:toggle-fold,alt-l:toggle-summary,alt-t:toggle-tail,alt-o:toggle-long-lines,alt-w:toggle-wrap,alt-n:next-match,alt-p:prev-match,"+
+		"alt-<:first,ctrl-home:first,alt->:last,ctrl-end:last,alt-g:go-to,"+
+		"alt-i:toggle-preview,shift-up:preview-up,shift-down:preview-down", b)
+
+	return b
+}
+
+// ParseBindings adds the comma separated key:action pairs in spec to b
+func ParseBindings(spec string, b Bindings) error {
+	for _, pair := range strings.Split(spec, ",") {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return fmt.Errorf("binding %q is not of the form key:action", pair)
+		}
+
+		if err := b.Bind(strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bind binds the named key to the named action
+func (b Bindings) Bind(key, action string) error {
+	k, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+
+	act, ok := actionNames[action]
+	if !ok {
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	b[k] = act
+	return nil
+}
+
+// ParseKey returns the key with the given name, such as ctrl-a, alt-left or x
+func ParseKey(name string) (int, error) {
+	mods := 0
+	s := name
+
+Prefix:
+	for {
+		lower := strings.ToLower(s)
+		switch {
+		case strings.HasPrefix(lower, "alt-"):
+			mods |= KEY_ALT
+		case strings.HasPrefix(lower, "shift-"):
+			mods |= KEY_SHIFT
+		case strings.HasPrefix(lower, "ctrl-") && len(s) > len("ctrl-")+1:
+			// ctrl- with a named key, like ctrl-left
+			mods |= KEY_CTRL
+		default:
+			break Prefix
+		}
+		s = s[strings.Index(s, "-")+1:]
+	}
+	lower := strings.ToLower(s)
+
+	// shift and ctrl only go with the named keys past the unicode range
+	special := mods&(KEY_SHIFT|KEY_CTRL) != 0
+
+	if k, ok := keyNames[lower]; ok && !(special && k <= utf8.MaxRune) {
+		return mods | k, nil
+	}
+
+	if len(lower) == len("ctrl-a") && strings.HasPrefix(lower, "ctrl-") &&
+		lower[5] >= 'a' && lower[5] <= 'z' && !special {
+		return mods | int(lower[5]-'a'+1), nil
+	}
+
+	// a single character, matched case sensitively
+	if r, size := utf8.DecodeRuneInString(s); size == len(s) && r != utf8.RuneError && r > ' ' && !special {
+		return mods | int(r), nil
+	}
+
+	return 0, fmt.Errorf("unknown key %q", name)
+}
@@ -0,0 +1,55 @@
+package vre
+
+import (
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		err      bool
+	}{
+		{"ctrl-a", KEY_CTRLA, false},
+		{"CTRL-W", KEY_CTRLW, false},
+		{"enter", KEY_ENTER, false},
+		{"alt-b", KEY_ALT | 'b', false},
+		{"alt-B", KEY_ALT | 'B', false},
+		{"alt-bspace", KEY_ALT | KEY_BACKSPACE, false},
+		{"ctrl-left", KEY_CTRL | KEY_LEFT, false},
+		{"shift-up", KEY_SHIFT | KEY_UP, false},
+		{"alt-ctrl-a", KEY_ALT | KEY_CTRLA, false},
+		{"x", 'x', false},
+		{"é", 'é', false},
+		{"-", '-', false},
+		{"space", ' ', false},
+		{"", 0, true},
+		{"ctrl-1", 0, true},
+		{"shift-a", 0, true},
+		{"ctrl-space", 0, true},
+		{"foo", 0, true},
+	}
+
+	for _, test := range tests {
+		output, err := ParseKey(test.input)
+		if (err != nil) != test.err || output != test.expected {
+			t.Errorf("Input: %v, Expected: %v (error %v), Got: %v (%v)", test.input, test.expected, test.err, output, err)
+		}
+	}
+}
+
+func TestParseBindings(t *testing.T) {
+	b := Bindings{}
+	if err := ParseBindings("ctrl-n:down, ctrl-p : up,colon:accept", b); err != nil {
+		t.Fatal(err)
+	}
+	if b[KEY_CTRLN] != ActDown || b[KEY_CTRLP] != ActUp || b[':'] != ActAccept {
+		t.Errorf("Got: %v", b)
+	}
+
+	for _, spec := range []string{"ctrl-n", "ctrl-n:dwon", "ctlr-n:down", "ctrl-n:down,"} {
+		if err := ParseBindings(spec, Bindings{}); err == nil {
+			t.Errorf("Input: %v, Expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package vre
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is what is read from the config file.  Each setting is kept in
+// the order it appears so that later ones win.
+type Config struct {
+	path     string
+	flags    []setting // default flags
+	bindings []setting // [bind] section
+	colors   []setting // [color] section
+}
+
+type setting struct {
+	key   string
+	value string
+	line  int
+}
+
+// Errorf returns an error pointing at setting s in the config file
+func (c *Config) Errorf(s setting, format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", c.path, s.line, fmt.Sprintf(format, a...))
+}
+
+// configPath returns $VRE_CONFIG if set, otherwise the config file under
+// the XDG config directory.  The bool is whether the path was explicitly given.
+func configPath() (string, bool) {
+	if path := os.Getenv("VRE_CONFIG"); path != "" {
+		return path, true
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "vre", "config"), false
+}
+
+// LoadConfig reads the config file.  A missing file is only an error if
+// it was given by $VRE_CONFIG.
+func LoadConfig() (*Config, error) {
+	path, explicit := configPath()
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return &Config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseConfig(path, f)
+}
+
+// ParseConfig parses an INI-style config.  Settings before any section
+// are default flags, without the leading dashes.
+//
+//	tabstop = 4
+//	theme = light
+//
+//	[bind]
+//	ctrl-n = down
+//
+//	[color]
+//	match = 1;32
+func ParseConfig(path string, f io.Reader) (*Config, error) {
+	c := Config{path: path}
+	section := ""
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section != "bind" && section != "color" {
+				return nil, fmt.Errorf("%s:%d: unknown section %q", path, n, section)
+			}
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		s := setting{
+			key:   strings.TrimSpace(line[:i]),
+			value: strings.TrimSpace(line[i+1:]),
+			line:  n,
+		}
+
+		switch section {
+		case "":
+			c.flags = append(c.flags, s)
+		case "bind":
+			c.bindings = append(c.bindings, s)
+		case "color":
+			c.colors = append(c.colors, s)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,89 @@
+package vre
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	input := `
+# defaults
+tabstop = 4
+theme = light
+bind = ctrl-n:down
+
+[bind]
+ctrl-p = up
+
+[color]
+match = 4;33
+`
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("NO_COLOR", "")
+
+	c, err := ParseConfig("config", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := ParseOptions([]string{"--tabstop", "2", "file"}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.tabstop != 2 {
+		t.Errorf("Expected tabstop 2 from the command line, Got: %v", opts.tabstop)
+	}
+	if opts.bindings[KEY_CTRLN] != ActDown || opts.bindings[KEY_CTRLP] != ActUp {
+		t.Errorf("Expected config bindings, Got: %v", opts.bindings)
+	}
+	if opts.theme.match != "\x1b[4;33m" || opts.theme.file != themes["light"].file {
+		t.Errorf("Expected light theme with match override, Got: %+v", opts.theme)
+	}
+	if len(opts.files) != 1 || opts.files[0] != "file" {
+		t.Errorf("Expected files [file], Got: %v", opts.files)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"tabstop 4", "config:1: expected key = value"},
+		{"[colour]", "config:1: unknown section"},
+		{"\ntabstp = 4", "config:2: unknown option"},
+		{"tabstop = four", "config:1: invalid value"},
+		{"theme = dark", "unknown theme"},
+		{"[bind]\nctrl-n = dwon", "config:2: unknown action"},
+		{"[color]\nmatch = green", "config:2: color \"match\" is not"},
+		{"history-size = -1", "history-size cannot be negative"},
+	}
+
+	for _, test := range tests {
+		c, err := ParseConfig("config", strings.NewReader(test.input))
+		if err == nil {
+			_, err = ParseOptions(nil, c)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Input: %q, Expected: %v, Got: %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestParseOptionsErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--tabstop", "0"}, "tabstop must be at least 1"},
+		{[]string{"--history-size", "-5"}, "history-size cannot be negative"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseOptions(test.args, &Config{})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Args: %q, Expected: %v, Got: %v", test.args, test.expected, err)
+		}
+	}
+}
@@ -1,20 +1,48 @@
 package vre
 
-// number of spaces in a tab
-var TABSTOP int = 8
+import (
+	"time"
+	"unicode/utf8"
+)
 
 // number of lines in a chunk
 const ChunkSize int = 250
 
 const console string = "/dev/tty"
 
-const fileColor = "\x1b[35;1m"
-const matchColor = "\x1b[32;1m"
+// columns in front of each line for the cursor and mark
+const gutterWidth = 2
+
+// number of files read at the same time
+const numReaders = 8
+
+// how often followed files are checked for new lines
+const followInterval = 250 * time.Millisecond
+
+// how often the machine sends search results while searching
+const progressInterval = 50 * time.Millisecond
+
+// how often the spinner turns while reading or searching
+const spinInterval = 100 * time.Millisecond
+
+// lines longer than this many bytes are only expanded around the part in
+// view, taking each byte as a column
+const longLineBytes = 4096
+
+// rows scrolled by each turn of the mouse wheel
+const wheelRows = 3
+
+// most rows of warnings shown
+const warningRows = 3
+
+// rows of files and values in the stats panel
+const statsRows = 5
 
 const (
 	EvtReadNew EventType = iota
 	EvtReadDone
 	EvtReadError
+	EvtReadWarning
 	EvtQuit
 	EvtSearchNew
 	EvtSearchFinal
@@ -25,19 +53,49 @@ const (
 )
 
 const (
+	KEY_CTRLA     = 1
 	KEY_CTRLB     = 2
 	KEY_CTRLC     = 3
 	KEY_CTRLD     = 4
+	KEY_CTRLE     = 5
 	KEY_CTRLF     = 6
+	KEY_CTRLG     = 7
 	KEY_CTRLH     = 8
+	KEY_TAB       = 9
 	KEY_CTRLJ     = 10
 	KEY_CTRLK     = 11
 	KEY_CTRLL     = 12
 	KEY_ENTER     = 13
+	KEY_CTRLN     = 14
+	KEY_CTRLO     = 15
+	KEY_CTRLP     = 16
+	KEY_CTRLR     = 18
 	KEY_CTRLT     = 20
+	KEY_CTRLU     = 21
+	KEY_CTRLW     = 23
+	KEY_CTRLY     = 25
 	KEY_ESC       = 27
 	KEY_BACKSPACE = 127
-	KEY_LEFT      = 279168
-	KEY_RIGHT     = 279167
-	KEY_DEL       = 2791126
+)
+
+// keys from escape sequences are numbered past the last unicode code point
+const (
+	KEY_UP = utf8.MaxRune + 1 + iota
+	KEY_DOWN
+	KEY_RIGHT
+	KEY_LEFT
+	KEY_HOME
+	KEY_END
+	KEY_DEL
+	KEY_PGUP
+	KEY_PGDN
+	KEY_MOUSE
+	KEY_UNKNOWN
+)
+
+// modifiers that are combined with a key
+const (
+	KEY_ALT   = 1 << 22
+	KEY_SHIFT = 1 << 23
+	KEY_CTRL  = 1 << 24
 )
@@ -1,17 +1,32 @@
 package vre
 
 import (
+	"flag"
 	"fmt"
 	"github.com/mattn/go-isatty"
 	"os"
 )
 
 func Run() {
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "vre:", err)
+		os.Exit(2)
+	}
+
+	opts, err := ParseOptions(os.Args[1:], config)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "vre:", err)
+		os.Exit(2)
+	}
+
 	doneChan := make(chan *Output)
 	eb := NewEventBox()
-	tui := NewTerminal(eb)
-	reader := NewReader(eb)
-	re := NewMachine(eb, doneChan)
+	tui := NewTerminal(eb, opts)
+	reader := NewReader(eb, opts)
+	re := NewMachine(eb, doneChan, opts)
 	files := 0
 
 	if !isatty.IsTerminal(os.Stdin.Fd()) {
@@ -20,7 +35,7 @@ func Run() {
 	} else {
 		// read in files
 		files = 1
-		go reader.ReadFiles(os.Args[1:])
+		go reader.ReadFiles(opts.files)
 	}
 
 	tui.Init(files)
@@ -30,6 +45,7 @@ func Run() {
 	done := false
 	early := false
 	readError := ""
+	var sel []LineRef
 	for !done {
 		eb.Wait(func(e *Events) {
 			for eventType, v := range *e {
@@ -39,10 +55,16 @@ func Run() {
 					s := v.(Query)
 					re.UpdateMachine(s)
 					if len(s.input) == 0 {
-						tui.ClearBounds()
+						tui.ClearBounds(s.v)
 					}
 
 				case EvtSearchFinal:
+					sel = v.([]LineRef)
+					if opts.follow {
+						// stop with the lines read so far
+						reader.Stop()
+						re.UpdateDoc(reader.Snapshot(), true)
+					}
 					re.Finish()
 					done = true
 
@@ -54,6 +76,9 @@ func Run() {
 					tui.UpdateChunks(ss, eventType == EvtReadDone)
 					re.UpdateDoc(ss, eventType == EvtReadDone)
 
+				case EvtReadWarning:
+					tui.UpdateWarnings(reader.Warnings())
+
 				case EvtReadError:
 					done = true
 					early = true
@@ -78,21 +103,27 @@ func Run() {
 		tui.Close()
 
 		if readError != "" {
-			fmt.Println("Problem reading " + readError)
+			fmt.Fprintln(os.Stderr, "vre:", readError)
+			os.Exit(2)
 		}
 	} else {
 		// print results
 		res := <-doneChan
 		tui.Close()
 
-		for i, d := range res.output {
-			for _, line := range d {
-				if !res.replace && files == 1 {
-					os.Stdout.WriteString(re.doc[i].filename + ":")
-				}
-				os.Stdout.Write(*line)
-				os.Stdout.WriteString("\n")
-			}
+		if res.err != nil {
+			fmt.Fprintln(os.Stderr, "vre:", res.err)
+			os.Exit(2)
+		}
+
+		NewPrinter(opts, files).Print(os.Stdout, res, sel)
+	}
+
+	// like grep, skipped files are an error even if there are matches
+	if warnings := reader.Warnings(); len(warnings) > 0 {
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, "vre:", w)
 		}
+		os.Exit(2)
 	}
 }
@@ -0,0 +1,185 @@
+package vre
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// term is one pattern of a query with several patterns
+type term struct {
+	prog  *Prog
+	not   bool // the line must not match
+	color int  // index of the color of its matches
+}
+
+// NewExpr compiles a query of patterns joined by the and and or
+// delimiters, like
+//
+//	/ERROR/ && /requestID/ && !/healthcheck/
+//
+// where ! negates a pattern and and binds tighter than or.  Empty
+// patterns, like the one being typed after a delimiter, are left out.
+// Only a pattern that is not negated can have a replacement.
+func NewExpr(s, and, or string, icase bool) (*Prog, error) {
+	var alts [][]term
+	var first *Prog
+	alt := make([]term, 0)
+	color := 0
+
+	for _, part := range splitQuery(s, and, or) {
+		if part == or {
+			if len(alt) > 0 {
+				alts = append(alts, alt)
+				alt = make([]term, 0)
+			}
+			continue
+		}
+
+		t := term{}
+		if strings.HasPrefix(part, "!") {
+			t.not = true
+			part = strings.TrimSpace(part[1:])
+		}
+		if strings.Trim(part, "/") == "" {
+			continue
+		}
+
+		t.prog = NewProg(part, icase)
+		if t.prog == nil {
+			return nil, fmt.Errorf("invalid query %q", s)
+		}
+		if t.not && t.prog.replace != nil {
+			return nil, fmt.Errorf("negated pattern %q cannot replace", part)
+		}
+		if !t.not {
+			if first == nil {
+				first = t.prog
+			}
+			t.color = color
+			color++
+		}
+		alt = append(alt, t)
+	}
+	if len(alt) > 0 {
+		alts = append(alts, alt)
+	}
+
+	if len(alts) == 0 {
+		return nil, fmt.Errorf("invalid query %q", s)
+	}
+	if len(alts) == 1 && len(alts[0]) == 1 && !alts[0][0].not {
+		// just one pattern
+		return first, nil
+	}
+
+	// re and replace come from the first pattern that is not negated,
+	// if any, since a negated one never matches a selected line
+	ret := Prog{}
+	if first != nil {
+		ret = *first
+	}
+	ret.alts = alts
+	return &ret, nil
+}
+
+// splitQuery splits s into its patterns and the or delimiters between
+// them.  A delimiter only counts once the pattern before it is closed and
+// the next one starts with a slash, so it can appear inside of patterns.
+func splitQuery(s, and, or string) []string {
+	res := make([]string, 0)
+	slashes := 0
+	last := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+			continue
+		case s[i] == '/':
+			slashes++
+			continue
+		case slashes < 2:
+			continue
+		}
+
+		delim := ""
+		if and != "" && strings.HasPrefix(s[i:], and) {
+			delim = and
+		} else if or != "" && strings.HasPrefix(s[i:], or) {
+			delim = or
+		} else {
+			continue
+		}
+
+		next := strings.TrimLeft(s[i+len(delim):], " \t!")
+		if next != "" && next[0] != '/' {
+			continue
+		}
+
+		res = append(res, strings.TrimSpace(s[last:i]))
+		if delim == or {
+			res = append(res, or)
+		}
+		i += len(delim) - 1
+		last = i + 1
+		slashes = 0
+	}
+
+	return append(res, strings.TrimSpace(s[last:]))
+}
+
+// Match returns the bounds of the matches in s and whether the line is
+// selected.  With several patterns, each bound also holds the color
+// index of its pattern.
+func (p *Prog) Match(s []byte) ([][]int, bool) {
+	if p.alts == nil {
+		bounds := p.Find(s)
+		return bounds, p.Selects(bounds)
+	}
+
+	bounds := make([][]int, 0)
+	found := false
+
+	for _, alt := range p.alts {
+		all := true
+		for _, t := range alt {
+			m := t.prog.Find(s)
+			if (len(m) > 0) == t.not {
+				all = false
+			}
+
+			if !t.not {
+				for _, b := range m {
+					bounds = append(bounds, []int{b[0], b[1], t.color})
+				}
+			}
+		}
+		found = found || all
+	}
+
+	return mergeBounds(bounds), found != p.invert
+}
+
+// mergeBounds sorts bounds and trims the overlapping ones so that the
+// earlier one wins
+func mergeBounds(bounds [][]int) [][]int {
+	sort.SliceStable(bounds, func(i, j int) bool {
+		return bounds[i][0] < bounds[j][0]
+	})
+
+	res := make([][]int, 0, len(bounds))
+	end := 0
+	for _, b := range bounds {
+		if b[1] <= end && len(res) > 0 {
+			continue
+		}
+		if b[0] < end {
+			b[0] = end
+		}
+		res = append(res, b)
+		end = b[1]
+	}
+
+	return res
+}
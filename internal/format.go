@@ -0,0 +1,110 @@
+package vre
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Template is an output format applied to each match, like
+// "{file}:{line}: {1} -> {name}".  The fields are
+//
+//	{file}    name of the file
+//	{line}    line number
+//	{col}     column of the match
+//	{text}    the whole line
+//	{0}       the whole match
+//	{n}       capture group n
+//	{name}    the capture group called name
+//
+// and {{ and }} are literal braces.
+type Template struct {
+	parts []tmplPart
+}
+
+// tmplPart is either literal text or a field
+type tmplPart struct {
+	text  string
+	field string
+}
+
+// ParseTemplate parses a --format template
+func ParseTemplate(s string) (*Template, error) {
+	t := Template{}
+	var lit strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			lit.WriteByte(s[i])
+			i++
+
+		case s[i] == '{':
+			j := strings.IndexByte(s[i:], '}')
+			if j < 0 {
+				return nil, fmt.Errorf("unclosed { in format %q", s)
+			}
+			field := s[i+1 : i+j]
+			if field == "" {
+				return nil, fmt.Errorf("empty {} in format %q", s)
+			}
+
+			if lit.Len() > 0 {
+				t.parts = append(t.parts, tmplPart{text: lit.String()})
+				lit.Reset()
+			}
+			t.parts = append(t.parts, tmplPart{field: field})
+			i += j
+
+		case s[i] == '}':
+			return nil, fmt.Errorf("unopened } in format %q", s)
+
+		default:
+			lit.WriteByte(s[i])
+		}
+	}
+
+	if lit.Len() > 0 {
+		t.parts = append(t.parts, tmplPart{text: lit.String()})
+	}
+
+	return &t, nil
+}
+
+// Expand appends the template filled in for one match to dst.  match holds
+// the submatch indices into line like regexp.FindSubmatchIndex returns, and
+// n is the zero-based line number.
+func (t *Template) Expand(dst []byte, re *regexp.Regexp, line []byte, match []int, file string, n int) []byte {
+	for _, p := range t.parts {
+		if p.field == "" {
+			dst = append(dst, p.text...)
+			continue
+		}
+
+		switch p.field {
+		case "file":
+			if file == "" {
+				file = "(standard input)"
+			}
+			dst = append(dst, file...)
+		case "line":
+			dst = strconv.AppendInt(dst, int64(n+1), 10)
+		case "col":
+			dst = strconv.AppendInt(dst, int64(match[0]+1), 10)
+		case "text":
+			dst = append(dst, line...)
+		default:
+			// groups that do not exist or did not match are empty like in regexp.Expand
+			g, err := strconv.Atoi(p.field)
+			if err != nil {
+				g = re.SubexpIndex(p.field)
+			}
+			if g >= 0 && 2*g+1 < len(match) && match[2*g] >= 0 {
+				dst = append(dst, line[match[2*g]:match[2*g+1]]...)
+			}
+		}
+	}
+
+	return dst
+}
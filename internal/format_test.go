@@ -0,0 +1,39 @@
+package vre
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	re := regexp.MustCompile(`(\w+)=(?P<value>\d+)`)
+	line := []byte("a=1 bb=22")
+
+	tests := []struct {
+		format   string
+		expected []string
+	}{
+		{"{file}:{line}:{col}: {1} -> {value}", []string{"f.go:3:1: a -> 1", "f.go:3:5: bb -> 22"}},
+		{"{0}|{2}|{3}|{nope}", []string{"a=1|1||", "bb=22|22||"}},
+		{"{{{1}}} {text}", []string{"{a} a=1 bb=22", "{bb} a=1 bb=22"}},
+	}
+
+	for _, test := range tests {
+		tmpl, err := ParseTemplate(test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, m := range re.FindAllSubmatchIndex(line, -1) {
+			if output := string(tmpl.Expand(nil, re, line, m, "f.go", 2)); output != test.expected[i] {
+				t.Errorf("Format: %v, Expected: %v, Got: %v", test.format, test.expected[i], output)
+			}
+		}
+	}
+
+	for _, format := range []string{"{1", "1}", "{}"} {
+		if _, err := ParseTemplate(format); err == nil {
+			t.Errorf("Format: %v, Expected error", format)
+		}
+	}
+}
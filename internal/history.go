@@ -0,0 +1,148 @@
+package vre
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// History holds the submitted queries, oldest first
+type History struct {
+	path    string
+	max     int
+	entries []string
+
+	pos   int    // entry being browsed, len(entries) if not browsing
+	saved string // input from before browsing started
+}
+
+// historyPath returns the location of the history file under the XDG state directory
+func historyPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "vre", "history")
+}
+
+// NewHistory loads the history file at path keeping at most max entries
+func NewHistory(path string, max int) *History {
+	h := &History{
+		path: path,
+		max:  max,
+	}
+	h.load()
+	h.pos = len(h.entries)
+
+	return h
+}
+
+// load reads the entries from the history file
+func (h *History) load() {
+	h.entries = h.entries[:0]
+	if h.path == "" {
+		return
+	}
+
+	f, err := os.Open(h.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.add(scanner.Text())
+	}
+}
+
+// add puts q at the end of the history, removing any earlier copy and
+// dropping the oldest entries past the size limit
+func (h *History) add(q string) {
+	if q == "" {
+		return
+	}
+
+	for i, e := range h.entries {
+		if e == q {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, q)
+
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
+
+// Append adds q to the history file.  The file is reread first so that
+// queries from other sessions are kept.
+func (h *History) Append(q string) error {
+	if h.path == "" || h.max <= 0 {
+		return nil
+	}
+
+	h.load()
+	h.add(q)
+	h.pos = len(h.entries)
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary file and rename so that the history is never truncated
+	tmp := h.path + ".tmp"
+	err := os.WriteFile(tmp, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// Prev returns the entry before the one being browsed.  input is the
+// current prompt which is restored once browsing goes past the newest entry.
+func (h *History) Prev(input string) (string, bool) {
+	if h.pos == 0 {
+		return "", false
+	}
+	if h.pos == len(h.entries) {
+		h.saved = input
+	}
+	h.pos--
+
+	return h.entries[h.pos], true
+}
+
+// Next returns the entry after the one being browsed
+func (h *History) Next() (string, bool) {
+	if h.pos >= len(h.entries) {
+		return "", false
+	}
+	h.pos++
+
+	if h.pos == len(h.entries) {
+		return h.saved, true
+	}
+	return h.entries[h.pos], true
+}
+
+// Search returns the index of the newest entry at or before from that contains s, or -1
+func (h *History) Search(s string, from int) int {
+	if from >= len(h.entries) {
+		from = len(h.entries) - 1
+	}
+
+	for i := from; i >= 0; i-- {
+		if strings.Contains(h.entries[i], s) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,65 @@
+package vre
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistoryAdd(t *testing.T) {
+	h := &History{max: 3}
+
+	for _, q := range []string{"/a/", "/b/", "", "/a/", "/c/", "/d/"} {
+		h.add(q)
+	}
+
+	expected := []string{"/a/", "/c/", "/d/"}
+	if !reflect.DeepEqual(h.entries, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, h.entries)
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := &History{max: 10, entries: []string{"/foo/", "/bar/", "/foobar/"}}
+
+	tests := []struct {
+		search   string
+		from     int
+		expected int
+	}{
+		{"foo", 10, 2},
+		{"foo", 1, 0},
+		{"bar", 2, 2},
+		{"bar", 0, -1},
+		{"baz", 2, -1},
+	}
+
+	for _, test := range tests {
+		if output := h.Search(test.search, test.from); output != test.expected {
+			t.Errorf("Search: %v, From: %v, Expected: %v, Got: %v", test.search, test.from, test.expected, output)
+		}
+	}
+}
+
+func TestHistoryBrowse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := NewHistory(path, 10)
+	h.Append("/foo/")
+	h.Append("/bar/")
+
+	h = NewHistory(path, 10)
+	if q, _ := h.Prev("/typed/"); q != "/bar/" {
+		t.Errorf("Expected: /bar/, Got: %v", q)
+	}
+	if q, _ := h.Prev("/bar/"); q != "/foo/" {
+		t.Errorf("Expected: /foo/, Got: %v", q)
+	}
+	if _, ok := h.Prev("/foo/"); ok {
+		t.Errorf("Expected no entry before the oldest")
+	}
+	h.Next()
+	if q, _ := h.Next(); q != "/typed/" {
+		t.Errorf("Expected: /typed/, Got: %v", q)
+	}
+}
@@ -0,0 +1,117 @@
+package vre
+
+import (
+	"bufio"
+	"encoding/json"
+)
+
+// jsonLine is the JSON record of a line with matches
+type jsonLine struct {
+	Type     string      `json:"type"`
+	File     string      `json:"file,omitempty"`
+	Line     int         `json:"line"`
+	Text     string      `json:"text"`
+	Replaced *string     `json:"replaced,omitempty"`
+	Matches  []jsonMatch `json:"matches"`
+}
+
+// jsonMatch is a match or capture group with byte offsets into the line
+type jsonMatch struct {
+	Index  int         `json:"index,omitempty"`
+	Name   string      `json:"name,omitempty"`
+	Start  int         `json:"start"`
+	End    int         `json:"end"`
+	Text   string      `json:"text"`
+	Groups []jsonMatch `json:"groups,omitempty"`
+}
+
+// jsonSummary is the last record
+type jsonSummary struct {
+	Type         string `json:"type"`
+	Files        int    `json:"files"`
+	MatchedFiles int    `json:"matched_files"`
+	Lines        int    `json:"lines"`
+	MatchedLines int    `json:"matched_lines"`
+	Matches      int    `json:"matches"`
+}
+
+// printJSON writes a record for each line and then a summary.  If sel is
+// nil, every line with a match is written.
+func (p *Printer) printJSON(out *bufio.Writer, o *Output, sel []LineRef) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+
+	if sel == nil {
+		sel = o.matches()
+	}
+
+	summary := jsonSummary{
+		Type:  "summary",
+		Files: len(o.doc),
+	}
+	for _, d := range o.doc {
+		summary.Lines += d.numLines
+	}
+
+	matched := make(map[int]bool)
+	for _, ref := range sel {
+		rec := o.jsonLine(ref)
+		enc.Encode(rec)
+
+		summary.MatchedLines++
+		summary.Matches += len(rec.Matches)
+		matched[ref.doc] = true
+	}
+	summary.MatchedFiles = len(matched)
+
+	enc.Encode(summary)
+}
+
+// jsonLine returns the record of line ref
+func (o *Output) jsonLine(ref LineRef) jsonLine {
+	line := o.doc[ref.doc].line(ref.line)
+
+	rec := jsonLine{
+		Type:    "match",
+		File:    o.doc[ref.doc].filename,
+		Line:    ref.line + 1,
+		Text:    string(line),
+		Matches: make([]jsonMatch, 0),
+	}
+
+	if o.replace {
+		r := string(*o.output[ref.doc][ref.line])
+		rec.Replaced = &r
+	}
+
+	if o.prog == nil {
+		return rec
+	}
+
+	for _, sm := range o.prog.FindSubmatch(line) {
+		m, names := sm.index, sm.re.SubexpNames()
+		match := jsonMatch{
+			Start: m[0],
+			End:   m[1],
+			Text:  string(line[m[0]:m[1]]),
+		}
+
+		for g := 1; 2*g < len(m); g++ {
+			if m[2*g] < 0 {
+				// group did not take part in the match
+				continue
+			}
+			match.Groups = append(match.Groups, jsonMatch{
+				Index: g,
+				Name:  names[g],
+				Start: m[2*g],
+				End:   m[2*g+1],
+				Text:  string(line[m[2*g]:m[2*g+1]]),
+			})
+		}
+
+		rec.Matches = append(rec.Matches, match)
+	}
+
+	return rec
+}
@@ -0,0 +1,82 @@
+package vre
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintJSON(t *testing.T) {
+	tests := []struct {
+		query    string
+		docs     []*Doc
+		sel      []LineRef
+		expected string
+	}{
+		{
+			`/id=(?P<v>\d+)/`,
+			[]*Doc{testDoc("ids.txt", "id=12", "x", "a id=3")},
+			nil,
+			`{"type":"match","file":"ids.txt","line":1,"text":"id=12","matches":[{"start":0,"end":5,"text":"id=12","groups":[{"index":1,"name":"v","start":3,"end":5,"text":"12"}]}]}
+{"type":"match","file":"ids.txt","line":3,"text":"a id=3","matches":[{"start":2,"end":6,"text":"id=3","groups":[{"index":1,"name":"v","start":5,"end":6,"text":"3"}]}]}
+{"type":"summary","files":1,"matched_files":1,"lines":3,"matched_lines":2,"matches":2}
+`,
+		},
+		{
+			// standard input has no file name, and offsets are in bytes
+			"/o/0/g",
+			[]*Doc{testDoc("", "föo", "bar")},
+			nil,
+			`{"type":"match","line":1,"text":"föo","replaced":"fö0","matches":[{"start":3,"end":4,"text":"o"}]}
+{"type":"summary","files":1,"matched_files":1,"lines":2,"matched_lines":1,"matches":1}
+`,
+		},
+		{
+			// groups that did not take part are left out
+			"/a(b)?<c>/",
+			[]*Doc{testDoc("f", "a<c>")},
+			nil,
+			`{"type":"match","file":"f","line":1,"text":"a<c>","matches":[{"start":0,"end":4,"text":"a<c>"}]}
+{"type":"summary","files":1,"matched_files":1,"lines":1,"matched_lines":1,"matches":1}
+`,
+		},
+		{
+			// the matches come from the pattern that is not negated
+			`!/health/ && /ERR(\d)/`,
+			[]*Doc{testDoc("f", "ERR1", "health ERR2")},
+			nil,
+			`{"type":"match","file":"f","line":1,"text":"ERR1","matches":[{"start":0,"end":4,"text":"ERR1","groups":[{"index":1,"start":3,"end":4,"text":"1"}]}]}
+{"type":"summary","files":1,"matched_files":1,"lines":2,"matched_lines":1,"matches":1}
+`,
+		},
+		{
+			// a line that only matches the second pattern
+			`/a(\d)/ || /b(?P<n>\d)/`,
+			[]*Doc{testDoc("f", "b2")},
+			nil,
+			`{"type":"match","file":"f","line":1,"text":"b2","matches":[{"start":0,"end":2,"text":"b2","groups":[{"index":1,"name":"n","start":1,"end":2,"text":"2"}]}]}
+{"type":"summary","files":1,"matched_files":1,"lines":1,"matched_lines":1,"matches":1}
+`,
+		},
+		{
+			// only the marked lines
+			"/x/",
+			[]*Doc{testDoc("a", "x1"), testDoc("b", "x2", "y")},
+			[]LineRef{{doc: 1, line: 0}},
+			`{"type":"match","file":"b","line":1,"text":"x2","matches":[{"start":0,"end":1,"text":"x"}]}
+{"type":"summary","files":2,"matched_files":1,"lines":3,"matched_lines":1,"matches":1}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		o := runQuery(t, test.query, test.docs...)
+
+		var buf bytes.Buffer
+		p := &Printer{json: true}
+		p.Print(&buf, o, test.sel)
+
+		if buf.String() != test.expected {
+			t.Errorf("Query: %q, Expected:\n%s\nGot:\n%s", test.query, test.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package vre
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mouse is a mouse event reported in SGR mouse mode
+type Mouse struct {
+	button  int // 0 to 2 for the left, middle and right buttons, 64 and 65 for the wheel
+	x       int // 0-based column
+	y       int // 0-based row
+	release bool
+}
+
+// Key is a key read from the terminal, with the mouse event if the key
+// is KEY_MOUSE
+type Key struct {
+	key   int
+	mouse Mouse
+}
+
+// pending is a reader that knows how much input it has read ahead, like
+// bufio.Reader.  Escape sequences arrive all at once, so an ESC with
+// nothing after it is a key of its own.
+type pending interface {
+	Buffered() int
+}
+
+// readKey decodes the next key from r.  Printable keys are returned as
+// their rune, control keys as their byte and escape sequences as one of
+// the KEY_* values past utf8.MaxRune, possibly combined with modifiers.
+func readKey(r io.ByteReader) (int, error) {
+	in, err := readInput(r)
+	return in.key, err
+}
+
+// readInput is like readKey but also decodes mouse events
+func readInput(r io.ByteReader) (Key, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return Key{}, err
+	}
+
+	if b == KEY_ESC {
+		if p, ok := r.(pending); ok && p.Buffered() == 0 {
+			// nothing came with it, so ESC was pressed on its own
+			return Key{key: KEY_ESC}, nil
+		}
+		return readEscape(r)
+	}
+	if b < utf8.RuneSelf {
+		return Key{key: int(b)}, nil
+	}
+	k, err := readRune(b, r)
+	return Key{key: k}, err
+}
+
+// readRune finishes reading the UTF-8 encoded rune starting with byte b
+func readRune(b byte, r io.ByteReader) (int, error) {
+	buf := []byte{b}
+
+	for !utf8.FullRune(buf) {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		buf = append(buf, c)
+	}
+
+	c, _ := utf8.DecodeRune(buf)
+	return int(c), nil
+}
+
+// readEscape reads what follows an ESC
+func readEscape(r io.ByteReader) (Key, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch {
+	case b == '[':
+		return readCSI(r)
+
+	case b == 'O':
+		// SS3 sequences sent by some terminals for arrows, home and end
+		c, err := r.ReadByte()
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{key: finalKey(c)}, nil
+
+	case b == KEY_ESC:
+		return Key{key: KEY_ESC}, nil
+
+	case b < utf8.RuneSelf:
+		// alt held with a key
+		return Key{key: KEY_ALT | int(b)}, nil
+
+	default:
+		c, err := readRune(b, r)
+		return Key{key: KEY_ALT | c}, err
+	}
+}
+
+// readCSI reads a control sequence of the form ESC [ params final
+func readCSI(r io.ByteReader) (Key, error) {
+	var params strings.Builder
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Key{}, err
+		}
+
+		if b >= 0x40 && b <= 0x7e {
+			p := params.String()
+			if strings.HasPrefix(p, "<") && (b == 'M' || b == 'm') {
+				return mouseKey(p[1:], b == 'm'), nil
+			}
+
+			// first parameter is the key for ~ sequences, second is the modifiers
+			fields := strings.Split(p, ";")
+			key := finalKey(b)
+			if b == '~' {
+				key = tildeKey(fields[0])
+			}
+			if key != KEY_UNKNOWN && len(fields) > 1 {
+				key |= modifiers(fields[1])
+			}
+			return Key{key: key}, nil
+		}
+
+		params.WriteByte(b)
+	}
+}
+
+// mouseKey decodes the parameters button;x;y of an SGR mouse event
+func mouseKey(params string, release bool) Key {
+	fields := strings.Split(params, ";")
+	if len(fields) != 3 {
+		return Key{key: KEY_UNKNOWN}
+	}
+
+	n := make([]int, 3)
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return Key{key: KEY_UNKNOWN}
+		}
+		n[i] = v
+	}
+
+	return Key{
+		key:   KEY_MOUSE,
+		mouse: Mouse{button: n[0], x: n[1] - 1, y: n[2] - 1, release: release},
+	}
+}
+
+// finalKey returns the key given by the final byte of CSI and SS3 sequences
+func finalKey(b byte) int {
+	switch b {
+	case 'A':
+		return KEY_UP
+	case 'B':
+		return KEY_DOWN
+	case 'C':
+		return KEY_RIGHT
+	case 'D':
+		return KEY_LEFT
+	case 'H':
+		return KEY_HOME
+	case 'F':
+		return KEY_END
+	}
+	return KEY_UNKNOWN
+}
+
+// tildeKey returns the key of sequences of the form ESC [ n ~
+func tildeKey(n string) int {
+	switch n {
+	case "1", "7":
+		return KEY_HOME
+	case "4", "8":
+		return KEY_END
+	case "3":
+		return KEY_DEL
+	case "5":
+		return KEY_PGUP
+	case "6":
+		return KEY_PGDN
+	}
+	return KEY_UNKNOWN
+}
+
+// modifiers decodes the xterm modifier parameter
+func modifiers(m string) int {
+	n, err := strconv.Atoi(m)
+	if err != nil || n < 2 {
+		return 0
+	}
+	n--
+
+	res := 0
+	if n&1 != 0 {
+		res |= KEY_SHIFT
+	}
+	if n&2 != 0 {
+		res |= KEY_ALT
+	}
+	if n&4 != 0 {
+		res |= KEY_CTRL
+	}
+	return res
+}
@@ -0,0 +1,122 @@
+package vre
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{"ab", []int{'a', 'b'}},
+		{"\x01\x7f\r", []int{KEY_CTRLA, KEY_BACKSPACE, KEY_ENTER}},
+		{"é世", []int{'é', '世'}},
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []int{KEY_UP, KEY_DOWN, KEY_RIGHT, KEY_LEFT}},
+		{"\x1b[H\x1b[F\x1bOH\x1bOF", []int{KEY_HOME, KEY_END, KEY_HOME, KEY_END}},
+		{"\x1b[1~\x1b[4~\x1b[7~\x1b[8~", []int{KEY_HOME, KEY_END, KEY_HOME, KEY_END}},
+		{"\x1b[3~\x1b[5~\x1b[6~", []int{KEY_DEL, KEY_PGUP, KEY_PGDN}},
+		{"\x1bb\x1bf\x1b\x7f", []int{KEY_ALT | 'b', KEY_ALT | 'f', KEY_ALT | KEY_BACKSPACE}},
+		{"\x1bé", []int{KEY_ALT | 'é'}},
+		{"\x1b[1;3D\x1b[1;5C\x1b[1;2A", []int{KEY_ALT | KEY_LEFT, KEY_CTRL | KEY_RIGHT, KEY_SHIFT | KEY_UP}},
+		{"\x1b[3;5~", []int{KEY_CTRL | KEY_DEL}},
+		{"\x1b\x1b", []int{KEY_ESC}},
+		{"\x1b[99~\x1b[Z", []int{KEY_UNKNOWN, KEY_UNKNOWN}},
+	}
+
+	for _, test := range tests {
+		r := bytes.NewReader([]byte(test.input))
+		output := []int{}
+
+		for {
+			k, err := readKey(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = append(output, k)
+		}
+
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("Input: %q, Expected: %v, Got: %v", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReadMouse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Key
+	}{
+		{"\x1b[<0;5;3M", Key{key: KEY_MOUSE, mouse: Mouse{button: 0, x: 4, y: 2}}},
+		{"\x1b[<0;5;3m", Key{key: KEY_MOUSE, mouse: Mouse{button: 0, x: 4, y: 2, release: true}}},
+		{"\x1b[<65;120;40M", Key{key: KEY_MOUSE, mouse: Mouse{button: 65, x: 119, y: 39}}},
+		{"\x1b[<0;5M", Key{key: KEY_UNKNOWN}},
+	}
+
+	for _, test := range tests {
+		in, err := readInput(bytes.NewReader([]byte(test.input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in != test.expected {
+			t.Errorf("Input: %q, Expected: %v, Got: %v", test.input, test.expected, in)
+		}
+	}
+}
+
+func TestReadEsc(t *testing.T) {
+	tests := []struct {
+		input    []string // what each read of the terminal returns
+		expected []int
+	}{
+		{[]string{"\x1b"}, []int{KEY_ESC}},
+		{[]string{"\x1b", "a"}, []int{KEY_ESC, 'a'}},
+		{[]string{"\x1ba"}, []int{KEY_ALT | 'a'}},
+		{[]string{"\x1b[A", "\x1b"}, []int{KEY_UP, KEY_ESC}},
+	}
+
+	for _, test := range tests {
+		r := bufio.NewReader(&reads{chunks: test.input})
+		output := []int{}
+		for range test.expected {
+			k, err := readKey(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = append(output, k)
+		}
+
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("Input: %q, Expected: %v, Got: %v", test.input, test.expected, output)
+		}
+	}
+}
+
+// reads returns one chunk per Read like a terminal returns what was typed
+type reads struct {
+	chunks []string
+}
+
+func (r *reads) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestReadKeyIncomplete(t *testing.T) {
+	for _, input := range []string{"\x1b", "\x1b[", "\x1b[1;", "\xe4\xb8"} {
+		if _, err := readKey(bytes.NewReader([]byte(input))); err != io.EOF {
+			t.Errorf("Input: %q, Expected: EOF, Got: %v", input, err)
+		}
+	}
+}
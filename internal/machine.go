@@ -2,12 +2,19 @@ package vre
 
 import (
 	"sync"
+	"time"
 )
 
 // Output.output is what gets printed at the end
 type Output struct {
-	replace bool
-	output  [][]*[]byte
+	prog       *Prog
+	replace    bool
+	doc        []*Doc
+	output     [][]*[]byte
+	matchLines [][]int
+	matchIndex []*Bounds
+	subIndex   []*Bounds
+	err        error // the query could not be compiled
 }
 
 // Result goes to tui for display
@@ -18,6 +25,9 @@ type Result struct {
 	matchLines [][]int
 	v          int
 	replace    bool
+	prog       *Prog
+	stats      *Stats
+	chunks     int // number of chunks searched
 }
 
 type Bounds struct {
@@ -30,25 +40,34 @@ type Machine struct {
 	localEb  *EventBox
 	doneChan chan<- *Output
 	mu       sync.Mutex
+	and      string // delimiters between patterns
+	or       string
 
 	sleep        bool
 	finalDoc     bool
 	finalMachine bool
 
 	doc       []*Doc
-	currDoc   int // current doc processing
-	currChunk int // current chunk processing
+	currDoc   int   // current doc processing
+	processed []int // number of lines processed of each doc
 
 	matchIndex []*Bounds
 	subIndex   []*Bounds
 	output     [][]*[]byte // output to be printed (index: doc, line)
-	matchLines [][]int     // lines of each doc that has a match (index: doc)
+	matchLines [][]int     // selected lines of each doc (index: doc)
+	stats      *Stats
 	v          int
+	err        error // set instead of prog if the query is invalid
+	sendEmpty  bool  // a result without matches is due for an invalid query
+
+	lastProgress time.Time // when the last snapshot was sent
 }
 
-func NewMachine(eb *EventBox, ch chan<- *Output) *Machine {
+func NewMachine(eb *EventBox, ch chan<- *Output, opts *Options) *Machine {
 	return &Machine{
 		mainEb:     eb,
+		and:        opts.and,
+		or:         opts.or,
 		localEb:    NewEventBox(),
 		mu:         sync.Mutex{},
 		doneChan:   ch,
@@ -59,79 +78,98 @@ func NewMachine(eb *EventBox, ch chan<- *Output) *Machine {
 	}
 }
 
-// Loop keep applying regexp to m.doc starting at m.curr
+// Loop keeps applying the regexp to the lines of m.doc that have not been
+// processed yet
 func (m *Machine) Loop() {
 	done := false
 	for !done {
-		// m.currDoc and m.currChunk has been initially set
-		// use to loop over m.doc
-		i := 0
 		for {
 			m.mu.Lock()
 
-			if m.currDoc < len(m.doc)-1 && m.currChunk == len(m.doc[m.currDoc].chunks) {
-				// hit end of current doc but them is another
-				m.currDoc++
-				m.currChunk = 0
-			}
-
 			// only way to exit the inner loop
-			if m.doc == nil || m.prog == nil ||
-				(m.currDoc == len(m.doc)-1 && m.currChunk == len(m.doc[m.currDoc].chunks)) {
+			if m.doc == nil || m.prog == nil || !m.nextDoc() {
 				break
 			}
 
-			doc := m.doc[m.currDoc]
-			ch := doc.chunks[m.currChunk]
-
-			// allocate new list per doc
-			for m.currDoc >= len(m.matchIndex) {
-				m.matchIndex = append(m.matchIndex, &Bounds{index: make([][ChunkSize][][]int, 0)})
-				m.output = append(m.output, make([]*[]byte, 0))
-				m.matchLines = append(m.matchLines, make([]int, 0))
-				m.subIndex = append(m.subIndex, &Bounds{index: make([][ChunkSize][][]int, 0)})
+			// process the rest of a chunk, which might have grown since
+			// it was last processed
+			d := m.currDoc
+			doc := m.doc[d]
+			start := m.processed[d]
+			c := start / ChunkSize
+			end := (c + 1) * ChunkSize
+			if end > doc.numLines {
+				end = doc.numLines
 			}
 
 			// allocate new bound per chunk
-			for m.currChunk >= len(m.matchIndex[m.currDoc].index) {
-				m.matchIndex[m.currDoc].index = append(m.matchIndex[m.currDoc].index, [ChunkSize][][]int{})
-				m.subIndex[m.currDoc].index = append(m.subIndex[m.currDoc].index, [ChunkSize][][]int{})
+			for c >= len(m.matchIndex[d].index) {
+				m.matchIndex[d].index = append(m.matchIndex[d].index, [ChunkSize][][]int{})
+				m.subIndex[d].index = append(m.subIndex[d].index, [ChunkSize][][]int{})
 			}
 
 			// record regexp output
-			for i, s := range ch.lines {
-				if s != nil {
-					if m.prog.replace == nil {
-						// only finding
-						m.matchIndex[m.currDoc].index[m.currChunk][i] = m.prog.Find(*s)
-						if len(m.matchIndex[m.currDoc].index[m.currChunk][i]) > 0 {
-							m.output[m.currDoc] = append(m.output[m.currDoc], ch.lines[i])
-							m.matchLines[m.currDoc] = append(m.matchLines[m.currDoc], m.currChunk*ChunkSize+i)
-						}
-					} else {
-						// replacing
-						oldBounds, newBounds, res := m.prog.Replace(*s)
-
-						m.matchIndex[m.currDoc].index[m.currChunk][i] = oldBounds
-						m.subIndex[m.currDoc].index[m.currChunk][i] = newBounds
-						m.output[m.currDoc] = append(m.output[m.currDoc], &res)
-						if len(m.matchIndex[m.currDoc].index[m.currChunk][i]) > 0 {
-							m.matchLines[m.currDoc] = append(m.matchLines[m.currDoc], m.currChunk*ChunkSize+i)
-						}
+			for line := start; line < end; line++ {
+				k := line % ChunkSize
+				s := doc.chunks[c].lines[k]
+
+				bounds, selected := m.prog.Match(*s)
+				m.matchIndex[d].index[c][k] = bounds
+				if selected {
+					m.matchLines[d] = append(m.matchLines[d], line)
+					m.stats.add(m.prog, d, *s, bounds)
+				}
+
+				if m.prog.replace == nil {
+					// only finding
+					if selected {
+						m.output[d] = append(m.output[d], s)
 					}
+				} else if selected {
+					// replacing, which only applies to the selected lines
+					_, newBounds, res := m.prog.Replace(*s)
+					m.subIndex[d].index[c][k] = newBounds
+					m.output[d] = append(m.output[d], &res)
+				} else {
+					m.subIndex[d].index[c][k] = nil
+					m.output[d] = append(m.output[d], s)
 				}
 			}
+			m.processed[d] = end
+
+			// snapshots copy every doc, so they are sent now and then
+			// rather than after each chunk
+			var res *Result
+			if time.Since(m.lastProgress) >= progressInterval || !m.nextDoc() {
+				m.lastProgress = time.Now()
+				res = m.Snapshot()
+			}
+			m.mu.Unlock()
 
-			m.currChunk++
-			i++
-			if i%50 == 0 || m.currChunk == len(doc.chunks) {
-				m.mainEb.Put(EvtSearchProgress, m.Snapshot())
+			// sent without holding m.mu since the handler of the main
+			// event box calls UpdateDoc
+			if res != nil {
+				m.mainEb.Put(EvtSearchProgress, res)
 			}
+		}
+		if m.finalDoc && m.finalMachine {
+			// the last update has been processed, and its wake up might
+			// have been used up already
 			m.mu.Unlock()
+			break
 		}
 		m.sleep = true
+		var res *Result
+		if m.sendEmpty {
+			m.sendEmpty = false
+			res = m.emptyResult()
+		}
 		m.mu.Unlock()
 
+		if res != nil {
+			m.mainEb.Put(EvtSearchProgress, res)
+		}
+
 		// finished current doc and wait for signal to continue/finish
 		m.localEb.Wait(func(events *Events) {
 			m.mu.Lock()
@@ -139,8 +177,7 @@ func (m *Machine) Loop() {
 
 			if m.finalDoc && m.finalMachine {
 				// we am done if all things am final and we am at the end
-				// we check in this order to avoid slice errors
-				done = m.currDoc == len(m.doc)-1 && m.currChunk == len(m.doc[m.currDoc].chunks)
+				done = m.prog == nil || !m.nextDoc()
 			}
 
 			m.mu.Unlock()
@@ -148,10 +185,65 @@ func (m *Machine) Loop() {
 	}
 
 	// send results
-	m.doneChan <- &Output{
-		output:  m.output,
-		replace: m.prog.replace != nil,
+	res := &Output{
+		doc:        m.doc,
+		output:     m.output,
+		matchLines: m.matchLines,
+		matchIndex: m.matchIndex,
+		subIndex:   m.subIndex,
+	}
+	res.prog = m.prog
+	if m.err != nil {
+		// an invalid query matches nothing
+		res.err = m.err
+		res.output, res.matchLines = nil, nil
+		res.matchIndex = nil
+	} else if m.prog == nil {
+		// an empty query matches everything
+		res.output, res.matchLines = allLines(m.doc)
+		res.matchIndex = nil
+	} else {
+		res.replace = m.prog.replace != nil
 	}
+	m.doneChan <- res
+}
+
+// nextDoc moves m.currDoc to the next doc with lines left to process,
+// wrapping around since followed docs keep growing.  It returns false if
+// every line has been processed.
+func (m *Machine) nextDoc() bool {
+	// allocate new list per doc
+	for len(m.matchIndex) < len(m.doc) {
+		m.matchIndex = append(m.matchIndex, &Bounds{index: make([][ChunkSize][][]int, 0)})
+		m.output = append(m.output, make([]*[]byte, 0))
+		m.matchLines = append(m.matchLines, make([]int, 0))
+		m.subIndex = append(m.subIndex, &Bounds{index: make([][ChunkSize][][]int, 0)})
+		m.processed = append(m.processed, 0)
+	}
+
+	for j := 0; j < len(m.doc); j++ {
+		d := (m.currDoc + j) % len(m.doc)
+		if m.processed[d] < m.doc[d].numLines {
+			m.currDoc = d
+			return true
+		}
+	}
+	return false
+}
+
+// allLines returns every line of the docs in the same form as Machine.output and Machine.matchLines
+func allLines(docs []*Doc) ([][]*[]byte, [][]int) {
+	output := make([][]*[]byte, len(docs))
+	matchLines := make([][]int, len(docs))
+
+	for i, d := range docs {
+		for k := 0; k < d.numLines; k++ {
+			output[i] = append(output[i], d.chunks[k/ChunkSize].lines[k%ChunkSize])
+			matchLines[i] = append(matchLines[i], k)
+		}
+	}
+
+	return output, matchLines
 }
 
 func (m *Machine) UpdateDoc(d []*Doc, final bool) {
@@ -160,63 +252,77 @@ func (m *Machine) UpdateDoc(d []*Doc, final bool) {
 	m.finalDoc = m.finalDoc || final
 
 	// wake up if asleep
-	if m.sleep {
-		m.sleep = false
+	wake := m.sleep
+	m.sleep = false
+	m.mu.Unlock()
+
+	// the event box keeps the event if the machine is not waiting yet,
+	// so it is put after unlocking like everywhere else
+	if wake {
 		m.localEb.Put(EvtReadNew, false)
 	}
-	m.mu.Unlock()
 }
 
-// UpdateMachine updates the regexp if possible
+// UpdateMachine updates the regexp if q is newer than the current query.
+// An empty query matches everything, while an invalid one matches nothing
+// and the machine sends a result without matches since there is nothing
+// to search.
 func (m *Machine) UpdateMachine(q Query) {
-	p := NewProg(q.input)
-
-	if len(q.input) == 0 || p == nil {
-		// not proper regexp
-		m.mu.Lock()
-		m.prog = nil
-		m.currDoc = 0
-		m.currChunk = 0
-		m.mu.Unlock()
-		return
+	p, err := NewExpr(q.input, m.and, m.or, q.icase)
+	if p != nil {
+		p.invert = q.invert
 	}
 
 	m.mu.Lock()
-	if m.v < q.v {
+	if m.v >= q.v {
 		// only update if newer query
-		m.v = q.v
-		for i := range m.matchIndex {
-			m.output[i] = make([]*[]byte, 0)
-			m.matchLines[i] = make([]int, 0)
-		}
-		m.prog = p
-
-		m.currDoc = 0
-		m.currChunk = 0
+		m.mu.Unlock()
+		return
+	}
 
-		if m.sleep {
-			m.sleep = false
-			m.localEb.Put(EvtFinish, false)
-		}
+	m.v = q.v
+	for i := range m.matchIndex {
+		m.output[i] = make([]*[]byte, 0)
+		m.matchLines[i] = make([]int, 0)
+		m.processed[i] = 0
 	}
+	m.prog = p
+	m.err = nil
+	if p == nil && len(q.input) > 0 {
+		m.err = err
+	}
+	m.stats = NewStats(len(m.matchIndex), q.stats)
+	m.lastProgress = time.Time{}
+	m.currDoc = 0
+
+	m.sendEmpty = m.err != nil
+
+	wake := m.sleep
+	m.sleep = false
 	m.mu.Unlock()
+
+	if wake {
+		m.localEb.Put(EvtFinish, false)
+	}
 }
 
 func (m *Machine) Finish() {
 	m.mu.Lock()
 	m.finalMachine = true
-	m.localEb.Put(EvtFinish, false)
 	m.mu.Unlock()
+
+	m.localEb.Put(EvtFinish, false)
 }
 
 // Snapshot returns a copy of the current outputs of the regexp program
 // It is called inside a critical section
 func (m *Machine) Snapshot() *Result {
 	res := Result{
-		matchIndex: make([]*Bounds, 0),
 		matchLines: make([][]int, len(m.matchLines)),
 		v:          m.v,
 		replace:    m.prog.replace != nil,
+		prog:       m.prog,
+		stats:      m.stats.Snapshot(statsRows),
 	}
 
 	for i, l := range m.matchLines {
@@ -224,21 +330,9 @@ func (m *Machine) Snapshot() *Result {
 		copy(res.matchLines[i], l)
 	}
 
-	for i, r := range m.matchIndex {
-		b := Bounds{}
-
-		if i < m.currDoc {
-			// a previous doc so copy everything
-			b.index = make([][ChunkSize][][]int, len(m.doc[i].chunks))
-			copy(b.index, r.index)
-		} else if i == m.currDoc {
-			b.index = make([][ChunkSize][][]int, m.currChunk)
-			copy(b.index, r.index[:m.currChunk])
-		} else {
-			break
-		}
-
-		res.matchIndex = append(res.matchIndex, &b)
+	res.matchIndex = m.snapshotBounds(m.matchIndex)
+	for _, b := range res.matchIndex {
+		res.chunks += len(b.index)
 	}
 
 	if m.prog.replace != nil {
@@ -248,25 +342,48 @@ func (m *Machine) Snapshot() *Result {
 			copy(res.output[i], d)
 		}
 
-		res.subIndex = make([]*Bounds, 0)
+		res.subIndex = m.snapshotBounds(m.subIndex)
+	}
 
-		for i, r := range m.subIndex {
-			b := Bounds{}
+	return &res
+}
 
-			if i < m.currDoc {
-				// a previous doc so copy everything
-				b.index = make([][ChunkSize][][]int, len(m.doc[i].chunks))
-				copy(b.index, r.index)
-			} else if i == m.currDoc {
-				b.index = make([][ChunkSize][][]int, m.currChunk)
-				copy(b.index, r.index[:m.currChunk])
-			} else {
-				break
-			}
+// emptyResult returns a result without matches in any line of the docs
+// so far.  It is called inside a critical section.
+func (m *Machine) emptyResult() *Result {
+	res := Result{
+		matchLines: make([][]int, len(m.doc)),
+		matchIndex: make([]*Bounds, len(m.doc)),
+		v:          m.v,
+	}
 
-			res.subIndex = append(res.subIndex, &b)
-		}
+	for i, d := range m.doc {
+		res.matchLines[i] = make([]int, 0)
+		res.matchIndex[i] = &Bounds{index: make([][ChunkSize][][]int, len(d.chunks))}
+		res.chunks += len(d.chunks)
 	}
 
 	return &res
 }
+
+// snapshotBounds copies the bounds of the processed lines in bs
+func (m *Machine) snapshotBounds(bs []*Bounds) []*Bounds {
+	res := make([]*Bounds, len(bs))
+
+	for i, r := range bs {
+		n := (m.processed[i] + ChunkSize - 1) / ChunkSize
+		b := Bounds{index: make([][ChunkSize][][]int, n)}
+		copy(b.index, r.index[:n])
+
+		if k := m.processed[i] % ChunkSize; k != 0 {
+			// the rest of the last chunk is from an earlier query
+			for j := k; j < ChunkSize; j++ {
+				b.index[n-1][j] = nil
+			}
+		}
+
+		res[i] = &b
+	}
+
+	return res
+}
@@ -0,0 +1,146 @@
+package vre
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDoc returns a doc named name with the given lines
+func testDoc(name string, lines ...string) *Doc {
+	d := &Doc{filename: name}
+	for i, l := range lines {
+		if i%ChunkSize == 0 {
+			d.chunks = append(d.chunks, &Chunk{})
+		}
+		b := []byte(l)
+		d.chunks[i/ChunkSize].lines[i%ChunkSize] = &b
+		d.numLines++
+		d.bytes += int64(len(b)) + 1
+	}
+	return d
+}
+
+// waitOutput returns the output of a machine, failing if it takes too long
+func waitOutput(t *testing.T, ch <-chan *Output) *Output {
+	select {
+	case o := <-ch:
+		return o
+	case <-time.After(5 * time.Second):
+		t.Fatal("the machine did not finish")
+		return nil
+	}
+}
+
+// runQuery returns the output of query over docs
+func runQuery(t *testing.T, query string, docs ...*Doc) *Output {
+	ch := make(chan *Output)
+	m := NewMachine(NewEventBox(), ch, &Options{and: "&&", or: "||"})
+	go m.Loop()
+
+	m.UpdateMachine(Query{input: query, v: 1})
+	m.UpdateDoc(docs, true)
+	m.Finish()
+
+	return waitOutput(t, ch)
+}
+
+func TestMachineFinalUpdate(t *testing.T) {
+	ch := make(chan *Output)
+	eb := NewEventBox()
+	m := NewMachine(eb, ch, &Options{and: "&&", or: "||"})
+	go m.Loop()
+
+	m.UpdateMachine(Query{input: "/b/", v: 1})
+	m.UpdateDoc([]*Doc{testDoc("x", "a")}, false)
+
+	// the machine sends its progress once it has run out of lines
+	eb.Wait(func(e *Events) {
+		eb.Clear()
+	})
+
+	// like ENTER in follow mode, where the last lines come with the finish
+	m.UpdateDoc([]*Doc{testDoc("x", "a", "b", "c", "b")}, true)
+	m.Finish()
+
+	o := waitOutput(t, ch)
+	if expected := [][]int{{1, 3}}; !reflect.DeepEqual(o.matchLines, expected) {
+		t.Errorf("Expected lines %v to match, Got: %v", expected, o.matchLines)
+	}
+}
+
+func TestMachineQuery(t *testing.T) {
+	tests := []struct {
+		input   string
+		lines   int
+		invalid bool
+	}{
+		{"", 3, false},
+		{"/b/", 1, false},
+		{"/b(/", 0, true},
+	}
+
+	for _, test := range tests {
+		o := runQuery(t, test.input, testDoc("x", "a", "b", "c"))
+		if (o.err != nil) != test.invalid {
+			t.Errorf("Query: %q, Expected invalid: %v, Got: %v", test.input, test.invalid, o.err)
+		}
+		if n := len(o.matches()); n != test.lines {
+			t.Errorf("Query: %q, Expected %d lines, Got: %d", test.input, test.lines, n)
+		}
+	}
+}
+
+func TestMachineInvalidQuery(t *testing.T) {
+	ch := make(chan *Output)
+	eb := NewEventBox()
+	m := NewMachine(eb, ch, &Options{and: "&&", or: "||"})
+	go m.Loop()
+
+	m.UpdateDoc([]*Doc{testDoc("x", "a", "b")}, false)
+
+	// like the main loop of core.go, which holds the event box while
+	// updating the machine
+	var res interface{}
+	eb.Put(EvtSearchNew, nil)
+	eb.Wait(func(e *Events) {
+		eb.Clear()
+		m.UpdateMachine(Query{input: "/b(/", v: 1})
+	})
+
+	// nothing is searched, so a result without matches is sent instead
+	eb.Wait(func(e *Events) {
+		res = (*e)[EvtSearchProgress]
+		eb.Clear()
+	})
+	if r, ok := res.(*Result); !ok || r.v != 1 || !reflect.DeepEqual(r.matchLines, [][]int{{}}) {
+		t.Fatalf("Expected a result without matches, Got: %+v", res)
+	}
+
+	m.UpdateDoc([]*Doc{testDoc("x", "a", "b")}, true)
+	m.Finish()
+	if o := waitOutput(t, ch); o.err == nil || len(o.matches()) != 0 {
+		t.Errorf("Expected an invalid query without matches, Got: %v and %v", o.err, o.matchLines)
+	}
+}
+
+func TestMachineOlderQuery(t *testing.T) {
+	tests := []string{"", "/b(/", "/a/"}
+
+	for _, input := range tests {
+		ch := make(chan *Output)
+		m := NewMachine(NewEventBox(), ch, &Options{and: "&&", or: "||"})
+		go m.Loop()
+
+		// the older query arrives late and is ignored
+		m.UpdateMachine(Query{input: "/b/", v: 2})
+		m.UpdateMachine(Query{input: input, v: 1})
+		m.UpdateDoc([]*Doc{testDoc("x", "a", "b")}, true)
+		m.Finish()
+
+		o := waitOutput(t, ch)
+		if expected := [][]int{{1}}; o.err != nil || !reflect.DeepEqual(o.matchLines, expected) {
+			t.Errorf("Older query %q: Expected lines %v, Got: %v and %v", input, expected, o.err, o.matchLines)
+		}
+	}
+}
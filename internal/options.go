@@ -0,0 +1,169 @@
+package vre
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mattn/go-isatty"
+	"io"
+	"os"
+)
+
+// Options holds the settings given on the command line and in the config file
+type Options struct {
+	pick         bool
+	number       bool
+	onlyMatching bool
+	format       *Template
+	json         bool
+	invert       bool
+	stats        bool
+	follow       bool
+	strict       bool
+	longLines    bool
+	wrap         bool
+	noMouse      bool
+	preview      string // right or bottom, empty for no preview pane
+
+	filesWithMatches  bool
+	filesWithoutMatch bool
+	count             bool
+
+	and         string
+	or          string
+	historySize int
+	tabstop     int
+	bindings    Bindings
+	theme       *Theme
+	outputTheme *Theme // colors for stdout, nil for plain output
+	files       []string
+}
+
+// ParseOptions parses the command line arguments (without the program
+// name).  Settings in the config c are applied first as defaults.
+func ParseOptions(args []string, c *Config) (*Options, error) {
+	opts := Options{
+		bindings: DefaultBindings(),
+	}
+	themeName := ""
+	color := ""
+
+	fs := flag.NewFlagSet("vre", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.pick, "p", false, "shorthand for --pick")
+	fs.BoolVar(&opts.pick, "pick", false, "ENTER outputs the marked lines or the line under the cursor")
+	fs.BoolVar(&opts.number, "n", false, "shorthand for --line-number")
+	fs.BoolVar(&opts.number, "line-number", false, "prefix output lines with their line numbers")
+	fs.BoolVar(&opts.invert, "v", false, "shorthand for --invert-match")
+	fs.BoolVar(&opts.invert, "invert-match", false, "select the lines that do not match")
+	fs.StringVar(&opts.and, "and", "&&", "delimiter between patterns that all have to match")
+	fs.StringVar(&opts.or, "or", "||", "delimiter between alternatives of patterns")
+	fs.BoolVar(&opts.follow, "f", false, "shorthand for --follow")
+	fs.BoolVar(&opts.follow, "follow", false, "keep reading the files as they grow, following rotated files, and scroll to new lines")
+	fs.BoolVar(&opts.strict, "strict", false, "quit if a file cannot be read instead of skipping it")
+	fs.BoolVar(&opts.longLines, "long-lines", false, "show each line from shortly before its first match when the match is out of view")
+	fs.BoolVar(&opts.wrap, "wrap", false, "wrap long lines onto the next rows instead of cutting them off")
+	fs.BoolVar(&opts.noMouse, "no-mouse", false, "leave the mouse to the terminal, for selecting text")
+	fs.Func("preview", "show the lines around the cursor line in a pane on the right or at the bottom", func(s string) error {
+		if s != "right" && s != "bottom" {
+			return fmt.Errorf("expected right or bottom")
+		}
+		opts.preview = s
+		return nil
+	})
+	fs.BoolVar(&opts.stats, "stats", false, "show the stats panel with match counts and the most common capture group values")
+	fs.BoolVar(&opts.filesWithMatches, "l", false, "shorthand for --files-with-matches")
+	fs.BoolVar(&opts.filesWithMatches, "files-with-matches", false, "print the names of the files with matches")
+	fs.BoolVar(&opts.filesWithoutMatch, "L", false, "shorthand for --files-without-match")
+	fs.BoolVar(&opts.filesWithoutMatch, "files-without-match", false, "print the names of the files without matches")
+	fs.BoolVar(&opts.count, "c", false, "shorthand for --count")
+	fs.BoolVar(&opts.count, "count", false, "print the number of matching lines of each file")
+	fs.BoolVar(&opts.onlyMatching, "o", false, "shorthand for --only-matching")
+	fs.BoolVar(&opts.onlyMatching, "only-matching", false, "print only the matches, or their replacements, one per line")
+	fs.Func("format", "print each match with a template like '{file}:{line}: {1} -> {name}'", func(s string) error {
+		t, err := ParseTemplate(s)
+		opts.format = t
+		return err
+	})
+	fs.BoolVar(&opts.json, "json", false, "print JSON Lines with the matches of each line and a summary")
+	fs.Func("bind", "comma separated key:action bindings, like ctrl-n:down,ctrl-p:up", func(s string) error {
+		return ParseBindings(s, opts.bindings)
+	})
+	fs.IntVar(&opts.historySize, "history-size", 1000, "number of queries kept in the history file (0 disables it)")
+	fs.IntVar(&opts.tabstop, "tabstop", 8, "number of spaces in a tab")
+	fs.StringVar(&themeName, "theme", "default", "color theme (default, light, basic or mono)")
+	fs.StringVar(&color, "color", "auto", "color the output: auto, always or never")
+
+	for _, s := range c.flags {
+		if fs.Lookup(s.key) == nil {
+			return nil, c.Errorf(s, "unknown option %q", s.key)
+		}
+		if err := fs.Set(s.key, s.value); err != nil {
+			return nil, c.Errorf(s, "invalid value %q for %s: %v", s.value, s.key, err)
+		}
+	}
+
+	for _, s := range c.bindings {
+		if err := opts.bindings.Bind(s.key, s.value); err != nil {
+			return nil, c.Errorf(s, "%v", err)
+		}
+	}
+
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, "usage: vre [options] [files...]")
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	opts.files = fs.Args()
+
+	if opts.tabstop < 1 {
+		return nil, fmt.Errorf("tabstop must be at least 1")
+	}
+	if opts.historySize < 0 {
+		return nil, fmt.Errorf("history-size cannot be negative")
+	}
+
+	colors := detectColors()
+	theme, err := opts.newTheme(themeName, colors, c)
+	if err != nil {
+		return nil, err
+	}
+	opts.theme = theme
+
+	switch color {
+	case "always":
+		// colors were asked for even if the terminal is monochrome
+		if colors == 0 {
+			colors = 16
+		}
+		opts.outputTheme, _ = opts.newTheme(themeName, colors, c)
+	case "auto":
+		if colors > 0 && isatty.IsTerminal(os.Stdout.Fd()) {
+			opts.outputTheme = theme
+		}
+	case "never":
+	default:
+		return nil, fmt.Errorf("invalid value %q for color: expected auto, always or never", color)
+	}
+
+	return &opts, nil
+}
+
+// newTheme returns the named theme for a terminal with the given number
+// of colors, with the colors from the config applied
+func (opts *Options) newTheme(name string, colors int, c *Config) (*Theme, error) {
+	theme, err := NewTheme(name, colors)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range c.colors {
+		if err := theme.SetColor(s.key, s.value); err != nil {
+			return nil, c.Errorf(s, "%v", err)
+		}
+	}
+
+	return theme, nil
+}
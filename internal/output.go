@@ -0,0 +1,247 @@
+package vre
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// LineRef points to a line of a doc
+type LineRef struct {
+	doc  int
+	line int
+}
+
+// Printer writes the final results
+type Printer struct {
+	files  int
+	number bool      // prefix lines with their line numbers
+	only   bool      // print only the matched parts of lines
+	format *Template // print each match with this, nil for whole lines
+	json   bool      // print JSON Lines
+
+	filesWithMatches  bool
+	filesWithoutMatch bool
+	count             bool
+
+	theme *Theme // nil for plain output
+}
+
+func NewPrinter(opts *Options, files int) *Printer {
+	return &Printer{
+		files:  files,
+		number: opts.number,
+		only:   opts.onlyMatching,
+		format: opts.format,
+		json:   opts.json,
+
+		filesWithMatches:  opts.filesWithMatches,
+		filesWithoutMatch: opts.filesWithoutMatch,
+		count:             opts.count,
+
+		theme: opts.outputTheme,
+	}
+}
+
+// Print writes the results in o to w.  If sel is not nil, only the
+// selected lines are written instead of every match.
+func (p *Printer) Print(w io.Writer, o *Output, sel []LineRef) {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	if p.json {
+		p.printJSON(out, o, sel)
+		return
+	}
+	if p.filesWithMatches || p.filesWithoutMatch || p.count {
+		p.printSummary(out, o, sel)
+		return
+	}
+
+	if sel == nil {
+		if p.format != nil {
+			sel = o.matches()
+		} else {
+			sel = o.lines()
+		}
+	}
+
+	for _, ref := range sel {
+		if p.format != nil {
+			p.printFormatted(out, o, ref)
+		} else {
+			p.printLine(out, o, ref)
+		}
+	}
+}
+
+// lines returns every line that gets printed when nothing is selected
+func (o *Output) lines() []LineRef {
+	if !o.replace || o.prog.invert {
+		return o.matches()
+	}
+
+	// the whole substituted doc
+	refs := make([]LineRef, 0)
+	for d := range o.output {
+		for i := range o.output[d] {
+			refs = append(refs, LineRef{doc: d, line: i})
+		}
+	}
+	return refs
+}
+
+// matches returns the selected lines, which are the lines with a match
+// unless the match is inverted
+func (o *Output) matches() []LineRef {
+	refs := make([]LineRef, 0)
+	for d := range o.matchLines {
+		for _, i := range o.matchLines[d] {
+			refs = append(refs, LineRef{doc: d, line: i})
+		}
+	}
+	return refs
+}
+
+// text returns the line to print and the bounds to highlight in it
+func (o *Output) text(ref LineRef) ([]byte, [][]int) {
+	if o.replace {
+		return *o.output[ref.doc][ref.line], boundsAt(o.subIndex, ref)
+	}
+	return o.doc[ref.doc].line(ref.line), boundsAt(o.matchIndex, ref)
+}
+
+// boundsAt returns the bounds of the line ref in b if there are any
+func boundsAt(b []*Bounds, ref LineRef) [][]int {
+	ch := ref.line / ChunkSize
+	if ref.doc >= len(b) || ch >= len(b[ref.doc].index) {
+		return nil
+	}
+	return b[ref.doc].index[ch][ref.line%ChunkSize]
+}
+
+// printPrefix writes the filename and line number in front of a line
+func (p *Printer) printPrefix(out *bufio.Writer, o *Output, ref LineRef) {
+	if !o.replace && p.files == 1 {
+		p.colored(out, p.fileColor(), o.doc[ref.doc].filename)
+		out.WriteString(":")
+	}
+	if p.number {
+		p.colored(out, p.numberColor(), strconv.Itoa(ref.line+1))
+		out.WriteString(":")
+	}
+}
+
+func (p *Printer) printLine(out *bufio.Writer, o *Output, ref LineRef) {
+	line, bounds := o.text(ref)
+
+	color := ""
+	if p.theme != nil {
+		color = p.theme.match
+		if o.replace {
+			color = p.theme.sub
+		}
+	}
+
+	if p.only {
+		// each match, or each replacement, on its own line
+		for _, b := range bounds {
+			p.printPrefix(out, o, ref)
+			p.colored(out, p.matchColor(b, color), string(line[b[0]:b[1]]))
+			out.WriteString("\n")
+		}
+		return
+	}
+
+	p.printPrefix(out, o, ref)
+	if p.theme == nil {
+		out.Write(line)
+	} else {
+		last := 0
+		for _, b := range bounds {
+			out.Write(line[last:b[0]])
+			p.colored(out, p.matchColor(b, color), string(line[b[0]:b[1]]))
+			last = b[1]
+		}
+		out.Write(line[last:])
+	}
+
+	out.WriteString("\n")
+}
+
+// printFormatted writes each match of the line with the format template
+func (p *Printer) printFormatted(out *bufio.Writer, o *Output, ref LineRef) {
+	if o.prog == nil {
+		return
+	}
+
+	line := o.doc[ref.doc].line(ref.line)
+	buf := make([]byte, 0)
+
+	for _, m := range o.prog.FindSubmatch(line) {
+		buf = p.format.Expand(buf[:0], m.re, line, m.index, o.doc[ref.doc].filename, ref.line)
+		out.Write(buf)
+		out.WriteString("\n")
+	}
+}
+
+// printSummary writes a line per doc instead of the lines themselves:
+// the names of the docs with or without selected lines, or their counts
+func (p *Printer) printSummary(out *bufio.Writer, o *Output, sel []LineRef) {
+	if sel == nil {
+		sel = o.matches()
+	}
+
+	counts := make([]int, len(o.doc))
+	for _, ref := range sel {
+		counts[ref.doc]++
+	}
+
+	for d, n := range counts {
+		name := o.doc[d].filename
+		if name == "" {
+			name = "(standard input)"
+		}
+
+		switch {
+		case p.count:
+			if p.files == 1 {
+				p.colored(out, p.fileColor(), name)
+				out.WriteString(":")
+			}
+			out.WriteString(strconv.Itoa(n) + "\n")
+		case p.filesWithMatches && n > 0, p.filesWithoutMatch && n == 0:
+			p.colored(out, p.fileColor(), name)
+			out.WriteString("\n")
+		}
+	}
+}
+
+func (p *Printer) colored(out *bufio.Writer, color, s string) {
+	if p.theme == nil || color == "" {
+		out.WriteString(s)
+	} else {
+		out.WriteString(color + s + "\x1b[0m")
+	}
+}
+
+func (p *Printer) matchColor(b []int, color string) string {
+	if p.theme == nil {
+		return color
+	}
+	return p.theme.matchColor(b, color)
+}
+
+func (p *Printer) fileColor() string {
+	if p.theme == nil {
+		return ""
+	}
+	return p.theme.file
+}
+
+func (p *Printer) numberColor() string {
+	if p.theme == nil {
+		return ""
+	}
+	return p.theme.number
+}
@@ -0,0 +1,127 @@
+package vre
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintSummary(t *testing.T) {
+	files := []*Doc{testDoc("a", "x", "y", "x"), testDoc("b", "y")}
+	stdin := []*Doc{testDoc("", "x", "y")}
+
+	tests := []struct {
+		name     string
+		printer  Printer
+		docs     []*Doc
+		sel      []LineRef
+		expected string
+	}{
+		{"count", Printer{files: 1, count: true}, files, nil, "a:2\nb:0\n"},
+		{"count stdin", Printer{count: true}, stdin, nil, "1\n"},
+		{"count marked", Printer{files: 1, count: true}, files, []LineRef{{doc: 0, line: 2}}, "a:1\nb:0\n"},
+		{"with matches", Printer{files: 1, filesWithMatches: true}, files, nil, "a\n"},
+		{"without match", Printer{files: 1, filesWithoutMatch: true}, files, nil, "b\n"},
+		{"with matches stdin", Printer{filesWithMatches: true}, stdin, nil, "(standard input)\n"},
+		{"without match stdin", Printer{filesWithoutMatch: true}, stdin, nil, ""},
+	}
+
+	for _, test := range tests {
+		o := runQuery(t, "/x/", test.docs...)
+
+		var buf bytes.Buffer
+		test.printer.Print(&buf, o, test.sel)
+
+		if buf.String() != test.expected {
+			t.Errorf("%s: Expected %q, Got: %q", test.name, test.expected, buf.String())
+		}
+	}
+}
+
+func TestPrintOnlyMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		printer  Printer
+		docs     []*Doc
+		expected string
+	}{
+		{"first match", "/o./", Printer{only: true}, []*Doc{testDoc("", "foo bog", "x")}, "oo\n"},
+		{"every match", "/o./g", Printer{only: true}, []*Doc{testDoc("", "foo bog", "x")}, "oo\nog\n"},
+		{"prefixed", "/o/g", Printer{only: true, files: 1, number: true}, []*Doc{testDoc("a", "x", "oo")}, "a:2:o\na:2:o\n"},
+		{"replaced", `/id=(\d+)/$1/g`, Printer{only: true}, []*Doc{testDoc("", "id=1 id=22")}, "1\n22\n"},
+		// the matches of both patterns in order
+		{"either pattern", "/b/ || /a/", Printer{only: true}, []*Doc{testDoc("", "ab", "b", "c")}, "a\nb\nb\n"},
+		{"both patterns", "/a/g && /b/", Printer{only: true}, []*Doc{testDoc("", "bab", "a")}, "b\na\n"},
+	}
+
+	for _, test := range tests {
+		o := runQuery(t, test.query, test.docs...)
+
+		var buf bytes.Buffer
+		test.printer.Print(&buf, o, nil)
+
+		if buf.String() != test.expected {
+			t.Errorf("%s: Expected %q, Got: %q", test.name, test.expected, buf.String())
+		}
+	}
+}
+
+func TestPrintColors(t *testing.T) {
+	const (
+		match  = "\x1b[32;1m"
+		match2 = "\x1b[36;1m"
+		sub    = "\x1b[33;1m"
+		file   = "\x1b[35;1m"
+		number = "\x1b[33m"
+		reset  = "\x1b[0m"
+	)
+
+	tests := []struct {
+		name     string
+		args     []string
+		query    string
+		docs     []*Doc
+		expected string
+	}{
+		{"never", []string{"--color", "never", "-n"}, "/b/", []*Doc{testDoc("f", "abc"), testDoc("g", "b")},
+			"f:1:abc\ng:1:b\n"},
+		{"always", []string{"--color", "always"}, "/b/g", []*Doc{testDoc("", "abcb", "x")},
+			"a" + match + "b" + reset + "c" + match + "b" + reset + "\n"},
+		{"prefixes", []string{"--color", "always", "-n"}, "/b/", []*Doc{testDoc("f", "abc"), testDoc("g", "b")},
+			file + "f" + reset + ":" + number + "1" + reset + ":a" + match + "b" + reset + "c\n" +
+				file + "g" + reset + ":" + number + "1" + reset + ":" + match + "b" + reset + "\n"},
+		// each pattern has its own color
+		{"patterns", []string{"--color", "always"}, "/a/ || /c/", []*Doc{testDoc("", "abc")},
+			match + "a" + reset + "b" + match2 + "c" + reset + "\n"},
+		{"only matching", []string{"--color", "always", "-o"}, "/a/ || /c/", []*Doc{testDoc("", "abc")},
+			match + "a" + reset + "\n" + match2 + "c" + reset + "\n"},
+		{"substitution", []string{"--color", "always"}, "/b/X/", []*Doc{testDoc("", "abc", "d")},
+			"a" + sub + "X" + reset + "c\nd\n"},
+	}
+
+	// a terminal with 16 colors, for the basic theme
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+	t.Setenv("COLORTERM", "")
+
+	for _, test := range tests {
+		opts, err := ParseOptions(test.args, &Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := runQuery(t, test.query, test.docs...)
+
+		// file names are only printed with several files
+		files := 0
+		if len(test.docs) > 1 {
+			files = 1
+		}
+
+		var buf bytes.Buffer
+		NewPrinter(opts, files).Print(&buf, o, nil)
+
+		if buf.String() != test.expected {
+			t.Errorf("%s: Expected %q, Got: %q", test.name, test.expected, buf.String())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package vre
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -39,13 +40,20 @@ func Parse(s string) *Input {
 	return &ret
 }
 
+// Prog is a compiled query.  When the query combines several patterns,
+// re, replace and n are those of the first one that is not negated.
 type Prog struct {
 	re      *regexp.Regexp
 	replace *string
 	n       int
+	invert  bool     // select the lines without a match
+	alts    [][]term // lines are selected if every term of one of these holds
 }
 
-func NewProg(s string) *Prog {
+// NewProg compiles the query s, ignoring case if icase is set or the query
+// has the i flag.  Only the first match of each line is used unless the
+// query has the g flag.
+func NewProg(s string, icase bool) *Prog {
 	i := Parse(s)
 	if i == nil {
 		return nil
@@ -54,7 +62,12 @@ func NewProg(s string) *Prog {
 	ret := Prog{}
 
 	// replace escaped \/ in pattern with just /
-	re, e := regexp.Compile(strings.ReplaceAll(i.pattern, `\/`, `/`))
+	pattern := strings.ReplaceAll(i.pattern, `\/`, `/`)
+	if icase || strings.Contains(i.flag, "i") {
+		pattern = "(?i)" + pattern
+	}
+
+	re, e := regexp.Compile(pattern)
 	if e != nil {
 		return nil
 	}
@@ -62,6 +75,10 @@ func NewProg(s string) *Prog {
 	ret.re = re
 	ret.replace = i.replace
 	ret.n = 1
+	if strings.Contains(i.flag, "g") {
+		// every match in the line
+		ret.n = -1
+	}
 
 	return &ret
 }
@@ -70,6 +87,60 @@ func (p *Prog) Find(s []byte) [][]int {
 	return p.re.FindAllIndex(s, p.n)
 }
 
+// Selects returns whether a line with the matches in bounds is selected
+func (p *Prog) Selects(bounds [][]int) bool {
+	return (len(bounds) > 0) != p.invert
+}
+
+// Submatch is a match and its capture groups, indexed like
+// regexp.FindSubmatchIndex returns, along with the pattern of the match
+type Submatch struct {
+	index []int
+	re    *regexp.Regexp
+}
+
+// FindSubmatch returns the matches in s and their capture groups.  With
+// several patterns, the matches of every pattern that is not negated are
+// returned in order, like the bounds of Match, leaving out the ones that
+// overlap an earlier match.
+func (p *Prog) FindSubmatch(s []byte) []Submatch {
+	if p.alts == nil {
+		return p.submatches(s)
+	}
+
+	res := make([]Submatch, 0)
+	for _, alt := range p.alts {
+		for _, t := range alt {
+			if !t.not {
+				res = append(res, t.prog.submatches(s)...)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].index[0] < res[j].index[0]
+	})
+
+	kept := res[:0]
+	end := 0
+	for _, m := range res {
+		if len(kept) > 0 && m.index[0] < end {
+			continue
+		}
+		kept = append(kept, m)
+		end = m.index[1]
+	}
+	return kept
+}
+
+// submatches returns the matches of p's own pattern in s
+func (p *Prog) submatches(s []byte) []Submatch {
+	res := make([]Submatch, 0)
+	for _, m := range p.re.FindAllSubmatchIndex(s, p.n) {
+		res = append(res, Submatch{index: m, re: p.re})
+	}
+	return res
+}
+
 // Replace returns (in order) the indices of the matches in the original
 // string, the indices of the replacements in the new string, and the new string
 func (p *Prog) Replace(s []byte) ([][]int, [][]int, []byte) {
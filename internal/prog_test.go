@@ -1,6 +1,7 @@
 package vre
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -59,3 +60,184 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestProgFlags(t *testing.T) {
+	tests := []struct {
+		input    string
+		icase    bool
+		expected int
+	}{
+		{"/a/", false, 1},
+		{"/a/g", false, 2},
+		{"/a/gi", false, 4},
+		{"/a/g", true, 4},
+		{"/a/b/g", false, 2},
+	}
+
+	for _, test := range tests {
+		p := NewProg(test.input, test.icase)
+		if output := len(p.Find([]byte("aAaA"))); output != test.expected {
+			t.Errorf("Input: %v, Icase: %v, Expected: %v matches, Got: %v", test.input, test.icase, test.expected, output)
+		}
+	}
+}
+
+func TestProgInvert(t *testing.T) {
+	tests := []struct {
+		line     string
+		invert   bool
+		expected bool
+	}{
+		{"foo", false, true},
+		{"bar", false, false},
+		{"foo", true, false},
+		{"bar", true, true},
+	}
+
+	for _, test := range tests {
+		p := NewProg("/foo/", false)
+		p.invert = test.invert
+		if output := p.Selects(p.Find([]byte(test.line))); output != test.expected {
+			t.Errorf("Line: %v, Invert: %v, Expected: %v, Got: %v", test.line, test.invert, test.expected, output)
+		}
+	}
+}
+
+func TestProgReplaceFlags(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		bounds   int
+	}{
+		// without g only the first match of the line is replaced
+		{"/o/0/", "f0o boo", 1},
+		{"/o/0/g", "f00 b00", 4},
+		{"/O/0/gi", "f00 b00", 4},
+	}
+
+	for _, test := range tests {
+		p := NewProg(test.input, false)
+		bounds, _, res := p.Replace([]byte("foo boo"))
+		if string(res) != test.expected || len(bounds) != test.bounds {
+			t.Errorf("Input: %v, Expected: %q with %d matches, Got: %q with %d", test.input, test.expected, test.bounds, res, len(bounds))
+		}
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"/a/", []string{"/a/"}},
+		{"/a/ && /b/", []string{"/a/", "/b/"}},
+		{"/a/i&&!/b/", []string{"/a/i", "!/b/"}},
+		{"/a/ || /b/ && /c/", []string{"/a/", "||", "/b/", "/c/"}},
+		{"/a && b/", []string{"/a && b/"}},
+		{"/a/x/ && c", []string{"/a/x/ && c"}},
+		{"/a/ && ", []string{"/a/", ""}},
+	}
+
+	for _, test := range tests {
+		output := splitQuery(test.input, "&&", "||")
+		if strings.Join(output, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("Input: %v, Expected: %q, Got: %q", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestExprMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		line     string
+		expected bool
+		bounds   int
+	}{
+		{"/ERROR/ && /req/ && !/health/", "ERROR req=1", true, 2},
+		{"/ERROR/ && /req/ && !/health/", "ERROR req=1 healthcheck", false, 2},
+		{"/ERROR/ && /req/ && !/health/", "ERROR", false, 1},
+		{"/a/ || /b/ && /c/", "a", true, 1},
+		{"/a/ || /b/ && /c/", "b", false, 1},
+		{"/a/ || /b/ && /c/", "bc", true, 2},
+		{"!/a/", "b", true, 0},
+		{"/abc/ && /b/", "abc", true, 1},
+		{"/a/ && //", "a", true, 1},
+	}
+
+	for _, test := range tests {
+		p, _ := NewExpr(test.input, "&&", "||", false)
+		bounds, output := p.Match([]byte(test.line))
+		if output != test.expected || len(bounds) != test.bounds {
+			t.Errorf("Input: %v, Line: %v, Expected: %v with %v bounds, Got: %v with %v", test.input, test.line, test.expected, test.bounds, output, bounds)
+		}
+	}
+}
+
+func TestExprFirstPattern(t *testing.T) {
+	tests := []struct {
+		input   string
+		line    string
+		matches int
+		output  string
+	}{
+		// re and replace come from the pattern that is not negated
+		{`!/health/ && /ERR(\d)/`, "ERR1 ERR2", 1, ""},
+		{`!/health/ && /ERR/E/`, "ERR1", 1, "E1"},
+		{`!/health/ && /ERR/E/g`, "ERR1 ERR2", 2, "E1 E2"},
+		{`!/health/`, "ERR1", 0, ""},
+	}
+
+	for _, test := range tests {
+		p, err := NewExpr(test.input, "&&", "||", false)
+		if err != nil {
+			t.Fatalf("Input: %v, Got: %v", test.input, err)
+		}
+		if n := len(p.FindSubmatch([]byte(test.line))); n != test.matches {
+			t.Errorf("Input: %v, Expected %d matches, Got: %d", test.input, test.matches, n)
+		}
+		if p.replace == nil {
+			continue
+		}
+		if _, _, res := p.Replace([]byte(test.line)); string(res) != test.output {
+			t.Errorf("Input: %v, Expected: %q, Got: %q", test.input, test.output, res)
+		}
+	}
+
+	for _, input := range []string{`!/health/x/ && /ERR/`, `/ERR/ || !/health/x/`, `/ERR(/`} {
+		if p, err := NewExpr(input, "&&", "||", false); p != nil || err == nil {
+			t.Errorf("Input: %v, Expected an error, Got: %v", input, p)
+		}
+	}
+}
+
+func TestExprFindSubmatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		line     string
+		expected []string
+	}{
+		{"/a(x)/ || /b(y)/", "by", []string{"by y"}},
+		{"/a(x)/ || /b(y)/", "ax by", []string{"ax x", "by y"}},
+		{"/a/g && /b/", "bab", []string{"b", "a"}},
+		// overlapping matches are left out like in Match
+		{"/abc/ && /b/", "abc", []string{"abc"}},
+		{"/a/ && !/b(c)/", "a", []string{"a"}},
+	}
+
+	for _, test := range tests {
+		p, _ := NewExpr(test.input, "&&", "||", false)
+		line := []byte(test.line)
+
+		res := make([]string, 0)
+		for _, m := range p.FindSubmatch(line) {
+			groups := make([]string, 0)
+			for g := 0; g < len(m.index); g += 2 {
+				groups = append(groups, string(line[m.index[g]:m.index[g+1]]))
+			}
+			res = append(res, strings.Join(groups, " "))
+		}
+		if strings.Join(res, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("Input: %v, Line: %v, Expected: %q, Got: %q", test.input, test.line, test.expected, res)
+		}
+	}
+}
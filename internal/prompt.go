@@ -0,0 +1,165 @@
+package vre
+
+import (
+	"unicode"
+)
+
+// Prompt is the line being edited.  The editing methods return whether
+// the text changed.
+type Prompt struct {
+	buf    []rune
+	cursor int    // index into buf
+	killed []rune // last text killed, for yanking
+}
+
+func (p *Prompt) String() string {
+	return string(p.buf)
+}
+
+// SetText replaces the text and puts the cursor at the end
+func (p *Prompt) SetText(s string) {
+	p.buf = []rune(s)
+	p.cursor = len(p.buf)
+}
+
+// Offset returns the number of runes after the cursor
+func (p *Prompt) Offset() int {
+	return len(p.buf) - p.cursor
+}
+
+func (p *Prompt) Insert(r rune) bool {
+	p.buf = append(p.buf[:p.cursor], append([]rune{r}, p.buf[p.cursor:]...)...)
+	p.cursor++
+	return true
+}
+
+func (p *Prompt) Left() {
+	if p.cursor > 0 {
+		p.cursor--
+	}
+}
+
+func (p *Prompt) Right() {
+	if p.cursor < len(p.buf) {
+		p.cursor++
+	}
+}
+
+func (p *Prompt) Home() {
+	p.cursor = 0
+}
+
+func (p *Prompt) End() {
+	p.cursor = len(p.buf)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wordLeft returns the start of the word before the cursor
+func (p *Prompt) wordLeft() int {
+	i := p.cursor
+	for i > 0 && !isWord(p.buf[i-1]) {
+		i--
+	}
+	for i > 0 && isWord(p.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordRight returns the end of the word after the cursor
+func (p *Prompt) wordRight() int {
+	i := p.cursor
+	for i < len(p.buf) && !isWord(p.buf[i]) {
+		i++
+	}
+	for i < len(p.buf) && isWord(p.buf[i]) {
+		i++
+	}
+	return i
+}
+
+func (p *Prompt) WordLeft() {
+	p.cursor = p.wordLeft()
+}
+
+func (p *Prompt) WordRight() {
+	p.cursor = p.wordRight()
+}
+
+// remove deletes buf[a:b] and moves the cursor to a
+func (p *Prompt) remove(a, b int) bool {
+	if a == b {
+		return false
+	}
+	p.buf = append(p.buf[:a], p.buf[b:]...)
+	p.cursor = a
+	return true
+}
+
+// kill removes buf[a:b] and saves it for yanking
+func (p *Prompt) kill(a, b int) bool {
+	if a == b {
+		return false
+	}
+	p.killed = append([]rune{}, p.buf[a:b]...)
+	return p.remove(a, b)
+}
+
+func (p *Prompt) Backspace() bool {
+	if p.cursor == 0 {
+		return false
+	}
+	return p.remove(p.cursor-1, p.cursor)
+}
+
+func (p *Prompt) Delete() bool {
+	if p.cursor == len(p.buf) {
+		return false
+	}
+	return p.remove(p.cursor, p.cursor+1)
+}
+
+// KillWordBack kills the word before the cursor
+func (p *Prompt) KillWordBack() bool {
+	return p.kill(p.wordLeft(), p.cursor)
+}
+
+// KillWordForward kills the word after the cursor
+func (p *Prompt) KillWordForward() bool {
+	return p.kill(p.cursor, p.wordRight())
+}
+
+// KillSpaceBack kills back to the previous whitespace like CTRL-W in a shell
+func (p *Prompt) KillSpaceBack() bool {
+	i := p.cursor
+	for i > 0 && unicode.IsSpace(p.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(p.buf[i-1]) {
+		i--
+	}
+	return p.kill(i, p.cursor)
+}
+
+func (p *Prompt) KillToStart() bool {
+	return p.kill(0, p.cursor)
+}
+
+func (p *Prompt) KillToEnd() bool {
+	return p.kill(p.cursor, len(p.buf))
+}
+
+// Yank inserts the last killed text
+func (p *Prompt) Yank() bool {
+	if len(p.killed) == 0 {
+		return false
+	}
+
+	rest := append([]rune{}, p.buf[p.cursor:]...)
+	p.buf = append(append(p.buf[:p.cursor], p.killed...), rest...)
+	p.cursor += len(p.killed)
+	return true
+}
@@ -0,0 +1,47 @@
+package vre
+
+import (
+	"testing"
+)
+
+func TestPromptEditing(t *testing.T) {
+	p := Prompt{}
+	for _, r := range "/foo bar/" {
+		p.Insert(r)
+	}
+
+	p.Left()
+	p.WordLeft()
+	if p.cursor != 5 {
+		t.Errorf("WordLeft: Expected cursor 5, Got: %v", p.cursor)
+	}
+
+	p.KillWordForward()
+	if p.String() != "/foo /" {
+		t.Errorf("KillWordForward: Expected /foo /, Got: %v", p.String())
+	}
+
+	p.Home()
+	p.Yank()
+	if p.String() != "bar/foo /" || p.cursor != 3 {
+		t.Errorf("Yank: Expected bar/foo / at 3, Got: %v at %v", p.String(), p.cursor)
+	}
+
+	p.End()
+	p.KillSpaceBack()
+	if p.String() != "bar/foo " {
+		t.Errorf("KillSpaceBack: Expected 'bar/foo ', Got: '%v'", p.String())
+	}
+
+	p.KillWordBack()
+	if p.String() != "bar/" {
+		t.Errorf("KillWordBack: Expected bar/, Got: %v", p.String())
+	}
+
+	p.SetText("日本語")
+	p.Left()
+	p.Backspace()
+	if p.String() != "日語" || p.Offset() != 1 {
+		t.Errorf("Backspace: Expected 日語 with offset 1, Got: %v with offset %v", p.String(), p.Offset())
+	}
+}
@@ -2,89 +2,275 @@ package vre
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"sync"
+	"time"
 )
 
 type Doc struct {
 	chunks   []*Chunk
 	filename string
 	numLines int
+	bytes    int64 // size of the lines including newlines
 }
 
+// Chunk holds ChunkSize lines.  The last chunk of a doc keeps filling up
+// after it is added, so only the first Doc.numLines lines of a snapshot
+// are safe to read.
 type Chunk struct {
 	lines [ChunkSize]*[]byte
-	num   int
+	num   int // only used by the reader
+}
+
+// line returns the i-th line of the doc
+func (d *Doc) line(i int) []byte {
+	return *d.chunks[i/ChunkSize].lines[i%ChunkSize]
 }
 
 // Reader acts as the model
 type Reader struct {
-	mu     sync.Mutex
-	mainEb *EventBox
-	doc    []*Doc
+	mu       sync.Mutex
+	mainEb   *EventBox
+	doc      []*Doc // in the order given, nil until opened or if it failed
+	opened   []bool // whether each doc has been opened or failed
+	follow   bool   // keep reading files at EOF
+	strict   bool   // stop at the first file that cannot be read
+	stopped  bool
+	warnings []string // files that could not be read
 }
 
-func NewReader(eb *EventBox) *Reader {
+func NewReader(eb *EventBox, opts *Options) *Reader {
 	return &Reader{
 		mainEb: eb,
 		mu:     sync.Mutex{},
 		doc:    make([]*Doc, 0),
+		follow: opts.follow,
+		strict: opts.strict,
+	}
+}
+
+// fail reports that file name could not be read, which ends vre in
+// strict mode and is a warning otherwise
+func (r *Reader) fail(name string, err error) {
+	msg := err.Error()
+	if pe, ok := err.(*os.PathError); ok {
+		msg = name + ": " + pe.Err.Error()
+	}
+
+	if r.strict {
+		r.mainEb.Put(EvtReadError, msg)
+		return
 	}
+
+	r.mu.Lock()
+	r.warnings = append(r.warnings, msg)
+	r.mu.Unlock()
+	r.mainEb.Put(EvtReadWarning, nil)
+}
+
+// Warnings returns the files that could not be read so far
+func (r *Reader) Warnings() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]string, len(r.warnings))
+	copy(res, r.warnings)
+	return res
 }
 
-// ReadFiles reads the files given
+// ReadFiles reads the files given with a pool of readers, skipping the
+// ones that cannot be opened unless in strict mode
 func (r *Reader) ReadFiles(fs []string) {
-	for i, fname := range fs {
-		f, err := os.Open(fname)
-		if err != nil {
-			r.mainEb.Put(EvtReadError, fname)
-		}
+	r.mu.Lock()
+	base := len(r.doc)
+	r.doc = append(r.doc, make([]*Doc, len(fs))...)
+	r.opened = append(r.opened, make([]bool, len(fs))...)
+	r.mu.Unlock()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < numReaders && w < len(fs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r.readFile(base+i, fs[i])
+			}
+		}()
+	}
+
+	for i := range fs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if !r.follow {
+		// report finished reading
+		r.mainEb.Put(EvtReadDone, nil)
+	}
+}
+
+// readFile opens file name as the i-th doc and reads it.  In follow mode
+// the file is read in the background since it does not end.
+func (r *Reader) readFile(i int, name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		r.mu.Lock()
+		r.opened[i] = true
+		r.mu.Unlock()
+
+		r.fail(name, err)
+		return
+	}
+
+	doc := &Doc{
+		chunks:   make([]*Chunk, 0),
+		filename: name,
+	}
+	r.mu.Lock()
+	r.doc[i] = doc
+	r.opened[i] = true
+	r.mu.Unlock()
 
-		r.ReadFile(f, fname, i == len(fs)-1)
+	if r.follow {
+		go r.read(doc, f, false)
+	} else {
+		r.read(doc, f, false)
 	}
 }
 
-// ReadStream reads the file in ChunkSize chunks and appends to Reader
-func (r *Reader) ReadFile(io *os.File, name string, final bool) {
+// ReadFile reads the file in ChunkSize chunks and appends to Reader.  The
+// lines read are published whenever a chunk fills up or the input would
+// block, so slow streams show up as they arrive.  In follow mode, regular
+// files are tailed after EOF until Stop is called.
+func (r *Reader) ReadFile(f *os.File, name string, final bool) {
+	r.read(r.newDoc(name), f, final)
+}
+
+// newDoc adds an empty doc for file name
+func (r *Reader) newDoc(name string) *Doc {
 	doc := Doc{
 		chunks:   make([]*Chunk, 0),
 		filename: name,
 	}
+	r.mu.Lock()
 	r.doc = append(r.doc, &doc)
+	r.opened = append(r.opened, true)
+	r.mu.Unlock()
+
+	return &doc
+}
 
-	reader := bufio.NewReaderSize(io, 64*1024)
+func (r *Reader) read(doc *Doc, f *os.File, final bool) {
+	name := doc.filename
+	reader := bufio.NewReaderSize(f, 64*1024)
 	chunk := &Chunk{}
+	published := 0   // lines of chunk already in doc
+	size := int64(0) // bytes of the lines not published yet
+	offset := int64(0)
+	var partial []byte // line without its newline yet
+
+	// publish makes the lines read so far visible in doc
+	publish := func() {
+		if chunk.num == published {
+			return
+		}
+		r.mu.Lock()
+		if published == 0 {
+			doc.chunks = append(doc.chunks, chunk)
+		}
+		doc.numLines += chunk.num - published
+		doc.bytes += size
+		r.mu.Unlock()
+		size = 0
+
+		published = chunk.num
+		if chunk.num == ChunkSize {
+			chunk = &Chunk{}
+			published = 0
+		}
+		r.mainEb.Put(EvtReadNew, nil)
+	}
+
+	addLine := func(line []byte) {
+		size += int64(len(line)) + 1
+		chunk.lines[chunk.num] = &line
+		chunk.num++
+		if chunk.num == ChunkSize {
+			publish()
+		}
+	}
 
 	for {
 		buf, err := reader.ReadBytes('\n')
-		if len(buf) > 0 && err == nil {
-			line := buf[:len(buf)-1]
-			chunk.lines[chunk.num] = &line
-			chunk.num++
-
-			if chunk.num == ChunkSize {
-				r.mu.Lock()
-				doc.chunks = append(doc.chunks, chunk)
-				doc.numLines += chunk.num
-				r.mu.Unlock()
-
-				chunk = &Chunk{}
-				r.mainEb.Put(EvtReadNew, nil)
+		offset += int64(len(buf))
+
+		if err == nil {
+			if partial != nil {
+				buf = append(partial, buf...)
+				partial = nil
+			}
+			addLine(buf[:len(buf)-1])
+			if reader.Buffered() == 0 {
+				// the next read might block
+				publish()
 			}
+			continue
 		}
-		if err != nil {
+
+		if len(buf) > 0 {
+			partial = append(partial, buf...)
+		}
+		if err != io.EOF {
+			// like reading a directory
+			r.fail(name, err)
+			break
+		}
+		if !r.follow || name == "" {
+			break
+		}
+
+		publish()
+		if !r.wait(f, name, offset) {
 			break
 		}
+
+		if fi, err := os.Stat(name); err == nil {
+			if cur, err := f.Stat(); err == nil && !os.SameFile(fi, cur) {
+				// the file was rotated so finish the old one and read the new one
+				if nf, err := os.Open(name); err == nil {
+					f.Close()
+					f = nf
+					reader.Reset(f)
+					offset = 0
+					if partial != nil {
+						addLine(partial)
+						partial = nil
+					}
+				}
+			} else if fi.Size() < offset {
+				// truncated so finish the line being written and start over
+				f.Seek(0, io.SeekStart)
+				reader.Reset(f)
+				offset = 0
+				if partial != nil {
+					addLine(partial)
+					partial = nil
+				}
+			}
+		}
 	}
 
-	if chunk.num != 0 {
-		r.mu.Lock()
-		doc.chunks = append(doc.chunks, chunk)
-		doc.numLines += chunk.num
-		r.mu.Unlock()
+	if partial != nil {
+		// last line without a newline
+		addLine(partial)
 	}
+	publish()
 
-	io.Close()
+	f.Close()
 
 	if final {
 		// report finished reading
@@ -94,11 +280,56 @@ func (r *Reader) ReadFile(io *os.File, name string, final bool) {
 	}
 }
 
-// Snapshot returns a copy of the current items in the document
+// wait sleeps until file name at offset has changed or Stop is called,
+// which makes it return false
+func (r *Reader) wait(f *os.File, name string, offset int64) bool {
+	for {
+		time.Sleep(followInterval)
+
+		r.mu.Lock()
+		stopped := r.stopped
+		r.mu.Unlock()
+		if stopped {
+			return false
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			// wait for a rotated file to be created
+			continue
+		}
+		if cur, err := f.Stat(); err != nil || !os.SameFile(fi, cur) || fi.Size() != offset {
+			return true
+		}
+	}
+}
+
+// Stop stops following the files
+func (r *Reader) Stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+}
+
+// Snapshot returns a copy of the current items in the document.  Docs
+// are only included once every doc before them has been opened, so that
+// they keep their place in later snapshots.
 func (r *Reader) Snapshot() []*Doc {
 	r.mu.Lock()
-	res := make([]*Doc, len(r.doc))
-	copy(res, r.doc)
+	res := make([]*Doc, 0, len(r.doc))
+	for i, d := range r.doc {
+		if !r.opened[i] {
+			break
+		}
+		if d == nil {
+			// could not be read
+			continue
+		}
+
+		// copy so that lines added later are not seen
+		c := *d
+		res = append(res, &c)
+	}
 	r.mu.Unlock()
 
 	return res
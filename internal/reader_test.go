@@ -0,0 +1,198 @@
+package vre
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the files with the given contents in a temporary
+// directory and returns their paths
+func writeFiles(t *testing.T, contents ...string) []string {
+	dir := t.TempDir()
+	paths := make([]string, len(contents))
+	for i, c := range contents {
+		paths[i] = filepath.Join(dir, string(rune('a'+i%26))+string(rune('a'+i/26)))
+		if err := os.WriteFile(paths[i], []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestReaderWarnings(t *testing.T) {
+	paths := writeFiles(t, "1\n2\n", "3")
+	dir := filepath.Dir(paths[0])
+	missing := filepath.Join(dir, "missing")
+
+	eb := NewEventBox()
+	r := NewReader(eb, &Options{})
+	r.ReadFiles([]string{paths[0], missing, dir, paths[1]})
+
+	// files are read at the same time, so warnings come in any order
+	expected := []string{missing + ": no such file or directory", dir + ": is a directory"}
+	w := r.Warnings()
+	sort.Strings(w)
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("Expected warnings %q, Got: %q", expected, w)
+	}
+
+	// the docs that could be opened are kept in order, even the
+	// directory that failed while reading
+	names := []string{}
+	lines := 0
+	for _, d := range r.Snapshot() {
+		names = append(names, d.filename)
+		lines += d.numLines
+	}
+	if expected := []string{paths[0], dir, paths[1]}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected docs %q, Got: %q", expected, names)
+	}
+	if lines != 3 {
+		t.Errorf("Expected 3 lines, Got: %v", lines)
+	}
+
+	if _, ok := eb.events[EvtReadWarning]; !ok {
+		t.Error("Expected a warning event")
+	}
+	if _, ok := eb.events[EvtReadDone]; !ok {
+		t.Error("Expected reading to be done")
+	}
+	if _, ok := eb.events[EvtReadError]; ok {
+		t.Error("Expected no error outside of strict mode")
+	}
+}
+
+func TestReaderStrict(t *testing.T) {
+	paths := writeFiles(t, "1\n")
+	missing := filepath.Join(filepath.Dir(paths[0]), "missing")
+
+	eb := NewEventBox()
+	r := NewReader(eb, &Options{strict: true})
+	r.ReadFiles([]string{missing, paths[0]})
+
+	if msg := eb.events[EvtReadError]; msg != missing+": no such file or directory" {
+		t.Errorf("Expected an error for the missing file, Got: %v", msg)
+	}
+	if w := r.Warnings(); len(w) != 0 {
+		t.Errorf("Expected no warnings in strict mode, Got: %q", w)
+	}
+}
+
+func TestReadFilesWithQuery(t *testing.T) {
+	contents := make([]string, 300)
+	for i := range contents {
+		contents[i] = strings.Repeat("foo\nbar\n", 100+i)
+	}
+	paths := writeFiles(t, contents...)
+	missing := filepath.Join(filepath.Dir(paths[0]), "missing")
+	args := append(append(append([]string{}, paths[:150]...), missing), paths[150:]...)
+
+	eb := NewEventBox()
+	ch := make(chan *Output)
+	opts := &Options{and: "&&", or: "||"}
+	r := NewReader(eb, opts)
+	m := NewMachine(eb, ch, opts)
+	go m.Loop()
+	m.UpdateMachine(Query{input: "/foo/", v: 1})
+	go r.ReadFiles(args)
+
+	// like the main loop of core.go, with ENTER once everything is read
+	go func() {
+		done := false
+		for !done {
+			eb.Wait(func(e *Events) {
+				for eventType := range *e {
+					switch eventType {
+					case EvtReadNew, EvtReadDone:
+						m.UpdateDoc(r.Snapshot(), eventType == EvtReadDone)
+						if eventType == EvtReadDone {
+							m.Finish()
+							done = true
+						}
+					}
+				}
+				eb.Clear()
+			})
+		}
+	}()
+
+	o := waitOutput(t, ch)
+	if len(o.doc) != len(paths) {
+		t.Fatalf("Expected %d docs, Got: %d", len(paths), len(o.doc))
+	}
+	for i, d := range o.doc {
+		if d.filename != paths[i] {
+			t.Fatalf("Expected doc %d to be %s, Got: %s", i, paths[i], d.filename)
+		}
+		if n := len(o.matchLines[i]); n != 100+i {
+			t.Fatalf("Expected %d matches in %s, Got: %d", 100+i, d.filename, n)
+		}
+	}
+}
+
+// waitLines returns the lines of the only doc of r once it has n of them,
+// failing if that takes too long
+func waitLines(t *testing.T, r *Reader, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if docs := r.Snapshot(); len(docs) == 1 && docs[0].numLines >= n {
+			lines := make([]string, docs[0].numLines)
+			for i := range lines {
+				lines[i] = string(docs[0].line(i))
+			}
+			return lines
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := 0
+	if docs := r.Snapshot(); len(docs) == 1 {
+		got = docs[0].numLines
+	}
+	t.Fatalf("Expected %d lines, Got: %d", n, got)
+	return nil
+}
+
+func TestReaderFollow(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string) error
+	}{
+		{"rotated", func(path string) error {
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte("3\n"), 0644)
+		}},
+		{"truncated", func(path string) error {
+			return os.WriteFile(path, []byte("3\n"), 0644)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the last line is still being written
+			path := writeFiles(t, "1\n2\nhalf")[0]
+
+			r := NewReader(NewEventBox(), &Options{follow: true})
+			defer r.Stop()
+			r.ReadFiles([]string{path})
+			waitLines(t, r, 2)
+
+			if err := test.change(path); err != nil {
+				t.Fatal(err)
+			}
+
+			// the half line is kept as it was rather than joined to the
+			// first line of the new contents
+			expected := []string{"1", "2", "half", "3"}
+			if lines := waitLines(t, r, 4); !reflect.DeepEqual(lines, expected) {
+				t.Errorf("Expected %q, Got: %q", expected, lines)
+			}
+		})
+	}
+}
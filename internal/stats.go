@@ -0,0 +1,94 @@
+package vre
+
+import (
+	"sort"
+	"strings"
+)
+
+// Stats counts the matches of a search for the stats panel
+type Stats struct {
+	matches    int            // matches in the selected lines
+	docMatches []int          // matches per doc
+	values     map[string]int // how often each capture group value occurs, nil if not counted
+	distinct   int            // number of values
+	top        []Count        // most common values, only in snapshots
+}
+
+// Count is how often key occurs
+type Count struct {
+	key string
+	n   int
+}
+
+// NewStats returns empty stats for docs, counting the capture group
+// values if values is set
+func NewStats(docs int, values bool) *Stats {
+	s := Stats{docMatches: make([]int, docs)}
+	if values {
+		s.values = make(map[string]int)
+	}
+	return &s
+}
+
+// add counts the matches in bounds of line s of doc d
+func (st *Stats) add(p *Prog, d int, s []byte, bounds [][]int) {
+	for d >= len(st.docMatches) {
+		st.docMatches = append(st.docMatches, 0)
+	}
+	st.matches += len(bounds)
+	st.docMatches[d] += len(bounds)
+
+	if st.values == nil || len(bounds) == 0 {
+		return
+	}
+
+	for _, sm := range p.FindSubmatch(s) {
+		m := sm.index
+		if len(m) == 2 {
+			// no groups so use the whole match
+			st.values[string(s[m[0]:m[1]])]++
+			continue
+		}
+
+		groups := make([]string, 0, len(m)/2-1)
+		for g := 2; g < len(m); g += 2 {
+			if m[g] >= 0 {
+				groups = append(groups, string(s[m[g]:m[g+1]]))
+			} else {
+				groups = append(groups, "")
+			}
+		}
+		st.values[strings.Join(groups, " ")]++
+	}
+}
+
+// Snapshot returns a copy with only the n most common values
+func (st *Stats) Snapshot(n int) *Stats {
+	res := Stats{
+		matches:    st.matches,
+		docMatches: make([]int, len(st.docMatches)),
+		distinct:   len(st.values),
+	}
+	copy(res.docMatches, st.docMatches)
+
+	res.top = make([]Count, 0, len(st.values))
+	for k, v := range st.values {
+		res.top = append(res.top, Count{key: k, n: v})
+	}
+	sortCounts(res.top)
+	if len(res.top) > n {
+		res.top = res.top[:n]
+	}
+
+	return &res
+}
+
+// sortCounts sorts the most common first, then by key
+func sortCounts(c []Count) {
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].n != c[j].n {
+			return c[i].n > c[j].n
+		}
+		return c[i].key < c[j].key
+	})
+}
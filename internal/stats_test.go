@@ -0,0 +1,53 @@
+package vre
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	lines := []string{"a=1 b=2", "a=1", "c=3", "a=2 x"}
+	p := NewProg("/(\\w)=(\\d)/g", false)
+	st := NewStats(0, true)
+
+	for i, l := range lines {
+		bounds, selected := p.Match([]byte(l))
+		if selected {
+			st.add(p, i%2, []byte(l), bounds)
+		}
+	}
+
+	res := st.Snapshot(2)
+	if res.matches != 5 {
+		t.Errorf("Expected 5 matches, Got: %v", res.matches)
+	}
+	if len(res.docMatches) != 2 || res.docMatches[0] != 3 || res.docMatches[1] != 2 {
+		t.Errorf("Expected [3 2] matches per doc, Got: %v", res.docMatches)
+	}
+	if res.distinct != 4 {
+		t.Errorf("Expected 4 distinct values, Got: %v", res.distinct)
+	}
+
+	expected := []Count{{"a 1", 2}, {"a 2", 1}}
+	if len(res.top) != len(expected) || res.top[0] != expected[0] || res.top[1] != expected[1] {
+		t.Errorf("Expected top values %v, Got: %v", expected, res.top)
+	}
+}
+
+func TestStatsSeveralPatterns(t *testing.T) {
+	p, _ := NewExpr("/a=(\\d)/ || /b=(\\d)/", "&&", "||", false)
+	st := NewStats(1, true)
+
+	// the second line only matches the second pattern
+	for _, l := range []string{"a=1", "b=1", "b=2"} {
+		bounds, selected := p.Match([]byte(l))
+		if selected {
+			st.add(p, 0, []byte(l), bounds)
+		}
+	}
+
+	res := st.Snapshot(2)
+	expected := []Count{{"1", 2}, {"2", 1}}
+	if len(res.top) != len(expected) || res.top[0] != expected[0] || res.top[1] != expected[1] {
+		t.Errorf("Expected top values %v, Got: %v", expected, res.top)
+	}
+}
@@ -0,0 +1,199 @@
+package vre
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Theme holds the escape sequences used for each part of the display
+type Theme struct {
+	match   string    // matched text
+	more    [3]string // matches of the second, third and fourth patterns
+	current string    // match jumped to
+	sub     string    // replaced text in the substitution view
+	file    string    // file headers
+	number  string    // line numbers in the output
+	dim     string    // lines without matches
+	text    string    // lines with matches
+	prompt  string    // prompt and separators
+	input   string    // query being typed
+	status  string    // counts on the status line
+	cursor  string    // cursor marker
+	marker  string    // marked line marker
+	warning string    // files that could not be read
+}
+
+var themes = map[string]Theme{
+	"default": {
+		match:   "\x1b[32;1m",
+		more:    [3]string{"\x1b[36;1m", "\x1b[33;1m", "\x1b[34;1m"},
+		current: "\x1b[1;38;5;16;48;5;40m",
+		sub:     "\x1b[32;1m",
+		file:    "\x1b[35;1m",
+		number:  "\x1b[33m",
+		dim:     "\x1b[38;5;244m",
+		text:    "\x1b[1;38;5;253m",
+		prompt:  "\x1b[31;1m",
+		input:   "\x1b[37;1m",
+		status:  "\x1b[37;1m",
+		cursor:  "\x1b[31;1m",
+		marker:  "\x1b[35;1m",
+		warning: "\x1b[33;1m",
+	},
+	// for terminals with only the 16 basic colors
+	"basic": {
+		match:   "\x1b[32;1m",
+		more:    [3]string{"\x1b[36;1m", "\x1b[35;1m", "\x1b[34;1m"},
+		current: "\x1b[30;42m",
+		sub:     "\x1b[33;1m",
+		file:    "\x1b[35;1m",
+		number:  "\x1b[33m",
+		dim:     "\x1b[37m",
+		text:    "\x1b[37;1m",
+		prompt:  "\x1b[31;1m",
+		input:   "\x1b[37;1m",
+		status:  "\x1b[37;1m",
+		cursor:  "\x1b[31;1m",
+		marker:  "\x1b[35;1m",
+		warning: "\x1b[33;1m",
+	},
+	// no colors, just reverse video, underline and bold
+	"mono": {
+		match:   "\x1b[7m",
+		more:    [3]string{"\x1b[7;1m", "\x1b[7;4m", "\x1b[7;1;4m"},
+		current: "\x1b[1;4m",
+		sub:     "\x1b[4m",
+		file:    "\x1b[1m",
+		number:  "",
+		dim:     "",
+		text:    "",
+		prompt:  "\x1b[1m",
+		input:   "",
+		status:  "\x1b[1m",
+		cursor:  "\x1b[1m",
+		marker:  "\x1b[1m",
+		warning: "\x1b[1m",
+	},
+	"light": {
+		match:   "\x1b[1;38;5;28m",
+		more:    [3]string{"\x1b[1;38;5;25m", "\x1b[1;38;5;166m", "\x1b[1;38;5;127m"},
+		current: "\x1b[1;38;5;231;48;5;28m",
+		sub:     "\x1b[1;38;5;94m",
+		file:    "\x1b[1;38;5;90m",
+		number:  "\x1b[38;5;130m",
+		dim:     "\x1b[38;5;246m",
+		text:    "\x1b[38;5;235m",
+		prompt:  "\x1b[1;38;5;160m",
+		input:   "\x1b[38;5;235m",
+		status:  "\x1b[1;38;5;238m",
+		cursor:  "\x1b[1;38;5;160m",
+		marker:  "\x1b[1;38;5;90m",
+		warning: "\x1b[1;38;5;130m",
+	},
+}
+
+// detectColors returns how many colors the terminal supports: 256, 16 or 0
+func detectColors() int {
+	if os.Getenv("NO_COLOR") != "" {
+		return 0
+	}
+
+	term := os.Getenv("TERM")
+	if term == "" || term == "dumb" {
+		return 0
+	}
+
+	colorterm := os.Getenv("COLORTERM")
+	if colorterm == "truecolor" || colorterm == "24bit" ||
+		strings.Contains(term, "256color") || strings.Contains(term, "direct") {
+		return 256
+	}
+
+	return 16
+}
+
+// NewTheme returns a copy of the named theme.  Terminals with fewer than
+// 256 colors get the basic or mono theme instead.
+func NewTheme(name string, colors int) (*Theme, error) {
+	th, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q", name)
+	}
+
+	if name != "mono" {
+		if colors == 0 {
+			th = themes["mono"]
+		} else if colors < 256 {
+			th = themes["basic"]
+		}
+	}
+
+	return &th, nil
+}
+
+// SetColor sets part of the theme to the SGR parameters in params, like 1;32 or 38;5;244
+func (th *Theme) SetColor(part, params string) error {
+	var p *string
+
+	switch part {
+	case "match":
+		p = &th.match
+	case "match2", "match3", "match4":
+		p = &th.more[part[5]-'2']
+	case "current":
+		p = &th.current
+	case "sub":
+		p = &th.sub
+	case "file":
+		p = &th.file
+	case "number":
+		p = &th.number
+	case "dim":
+		p = &th.dim
+	case "text":
+		p = &th.text
+	case "prompt":
+		p = &th.prompt
+	case "input":
+		p = &th.input
+	case "status":
+		p = &th.status
+	case "cursor":
+		p = &th.cursor
+	case "marker":
+		p = &th.marker
+	case "warning":
+		p = &th.warning
+	default:
+		return fmt.Errorf("unknown color %q", part)
+	}
+
+	for _, c := range params {
+		if (c < '0' || c > '9') && c != ';' {
+			return fmt.Errorf("color %q is not a list of SGR parameters: %q", part, params)
+		}
+	}
+
+	*p = "\x1b[" + strings.Trim(params, ";") + "m"
+	return nil
+}
+
+// matchColor returns the color of the match in bounds b, which has the
+// index of its pattern after the bounds if the query has several.  A
+// fourth element marks the match jumped to.
+func (th *Theme) matchColor(b []int, color string) string {
+	if len(b) > 3 {
+		return th.current
+	}
+	if len(b) < 3 || b[2] == 0 {
+		return color
+	}
+	return th.more[(b[2]-1)%len(th.more)]
+}
+
+// Style is how lines are drawn
+type Style struct {
+	theme   *Theme
+	tabstop int
+}
@@ -0,0 +1,105 @@
+package vre
+
+import (
+	"testing"
+)
+
+func TestDetectColors(t *testing.T) {
+	tests := []struct {
+		noColor   string
+		term      string
+		colorterm string
+		expected  int
+	}{
+		{"", "xterm-256color", "", 256},
+		{"", "xterm", "truecolor", 256},
+		{"", "xterm", "24bit", 256},
+		{"", "xterm-direct", "", 256},
+		{"", "xterm", "", 16},
+		{"", "linux", "", 16},
+		{"", "dumb", "truecolor", 0},
+		{"", "", "", 0},
+		// NO_COLOR wins over everything
+		{"1", "xterm-256color", "truecolor", 0},
+	}
+
+	for _, test := range tests {
+		t.Setenv("NO_COLOR", test.noColor)
+		t.Setenv("TERM", test.term)
+		t.Setenv("COLORTERM", test.colorterm)
+
+		if colors := detectColors(); colors != test.expected {
+			t.Errorf("NO_COLOR=%q TERM=%q COLORTERM=%q: Expected %d colors, Got: %d", test.noColor, test.term, test.colorterm, test.expected, colors)
+		}
+	}
+}
+
+func TestNewTheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		colors   int
+		expected string
+	}{
+		{"default", 256, "default"},
+		{"light", 256, "light"},
+		{"basic", 256, "basic"},
+		// fewer colors fall back to the themes that can show them
+		{"default", 16, "basic"},
+		{"light", 16, "basic"},
+		{"default", 0, "mono"},
+		{"basic", 0, "mono"},
+		{"mono", 256, "mono"},
+	}
+
+	for _, test := range tests {
+		th, err := NewTheme(test.name, test.colors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *th != themes[test.expected] {
+			t.Errorf("Theme %q with %d colors: Expected the %s theme, Got: %+v", test.name, test.colors, test.expected, th)
+		}
+	}
+
+	if _, err := NewTheme("dark", 256); err == nil {
+		t.Error("Expected an error for an unknown theme")
+	}
+}
+
+func TestParseOptionsColors(t *testing.T) {
+	tests := []struct {
+		noColor string
+		term    string
+		color   string
+		theme   string // of the terminal
+		output  string // of the printed output, "" for none
+	}{
+		{"", "xterm-256color", "always", "default", "default"},
+		{"", "xterm", "always", "basic", "basic"},
+		{"1", "xterm-256color", "always", "mono", "basic"},
+		{"", "dumb", "never", "mono", ""},
+		{"", "xterm-256color", "never", "default", ""},
+		{"", "dumb", "auto", "mono", ""},
+	}
+
+	for _, test := range tests {
+		t.Setenv("NO_COLOR", test.noColor)
+		t.Setenv("TERM", test.term)
+		t.Setenv("COLORTERM", "")
+
+		opts, err := ParseOptions([]string{"--color", test.color}, &Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *opts.theme != themes[test.theme] {
+			t.Errorf("NO_COLOR=%q TERM=%q: Expected the %s theme, Got: %+v", test.noColor, test.term, test.theme, opts.theme)
+		}
+		if test.output == "" {
+			if opts.outputTheme != nil {
+				t.Errorf("NO_COLOR=%q TERM=%q --color=%s: Expected no output colors, Got: %+v", test.noColor, test.term, test.color, opts.outputTheme)
+			}
+		} else if opts.outputTheme == nil || *opts.outputTheme != themes[test.output] {
+			t.Errorf("NO_COLOR=%q TERM=%q --color=%s: Expected the %s output theme, Got: %+v", test.noColor, test.term, test.color, test.output, opts.outputTheme)
+		}
+	}
+}
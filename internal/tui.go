@@ -1,19 +1,24 @@
 package vre
 
 import (
+	"bufio"
 	"fmt"
 	"golang.org/x/crypto/ssh/terminal"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
+	"unicode/utf8"
 )
 
-// expandTabs expands all tabs up to TABSTOP spaces and modifies boundaries to accomodate
-func expandTabs(s []byte, bounds [][]int) (string, [][]int) {
+// expandTabs expands all tabs up to st.tabstop spaces and modifies boundaries to accomodate
+func (st *Style) expandTabs(s []byte, bounds [][]int) (string, [][]int) {
 	if len(s) == 0 {
 		return "", make([][]int, 0)
 	}
@@ -32,43 +37,49 @@ func expandTabs(s []byte, bounds [][]int) (string, [][]int) {
 		// mark first number of an interval greater than 0
 		if bounds[0][0] == 0 {
 			curr = 1
-			nbounds[0] = []int{0, 0}
+			nbounds[0] = append([]int{0, 0}, bounds[0][2:]...)
 		} else {
 			curr = 0
 		}
 	}
 
 	for j, c := range s {
-		if c == '\t' {
-			buf.Write(s[last:j])
-
-			n := TABSTOP - buf.Len()%TABSTOP
-			buf.Write([]byte(strings.Repeat(" ", n)))
-
-			pad += n - 1
-			last = j + 1
-		}
-
-		// update bounds if any passed
+		// update bounds at or before j, which do not include the tab at j
 		if curr != -1 {
 			for ; curr < 2*len(bounds) && bounds[curr/2][curr%2] <= j; curr++ {
 				if curr%2 == 0 {
-					nbounds[curr/2] = []int{bounds[curr/2][0] + pad, 0}
+					nbounds[curr/2] = append([]int{bounds[curr/2][0] + pad, 0}, bounds[curr/2][2:]...)
 				} else {
 					nbounds[curr/2][1] = bounds[curr/2][1] + pad
 				}
 			}
 		}
+
+		if c == '\t' {
+			buf.Write(s[last:j])
+
+			n := st.tabstop - buf.Len()%st.tabstop
+			buf.Write([]byte(strings.Repeat(" ", n)))
+
+			pad += n - 1
+			last = j + 1
+		}
 	}
 
 	if curr != -1 {
 		for ; curr < 2*len(bounds) && bounds[curr/2][curr%2] <= len(s); curr++ {
 			if curr%2 == 0 {
-				nbounds[curr/2] = []int{bounds[curr/2][0] + pad, 0}
+				nbounds[curr/2] = append([]int{bounds[curr/2][0] + pad, 0}, bounds[curr/2][2:]...)
 			} else {
 				nbounds[curr/2][1] = bounds[curr/2][1] + pad
 			}
 		}
+
+		// cut off bounds past the end of s
+		if curr%2 == 1 {
+			nbounds[curr/2][1] = len(s) + pad
+		}
+		nbounds = nbounds[:(curr+1)/2]
 	}
 
 	buf.Write(s[last:])
@@ -76,10 +87,50 @@ func expandTabs(s []byte, bounds [][]int) (string, [][]int) {
 	return buf.String(), nbounds
 }
 
+// clip returns the bytes of s from a to b, widened to whole runes, with
+// bnds moved to match and cut to fit
+func clip(s []byte, bnds [][]int, a, b int) ([]byte, [][]int) {
+	if a > len(s) {
+		a = len(s)
+	}
+	if b > len(s) {
+		b = len(s)
+	}
+	for a > 0 && !utf8.RuneStart(s[a]) {
+		a--
+	}
+	for b < len(s) && !utf8.RuneStart(s[b]) {
+		b++
+	}
+
+	bounds := make([][]int, 0, len(bnds))
+	for _, I := range bnds {
+		if I[1] <= a || I[0] >= b {
+			continue
+		}
+		J := append([]int{I[0] - a, I[1] - a}, I[2:]...)
+		if J[0] < 0 {
+			J[0] = 0
+		}
+		if J[1] > b-a {
+			J[1] = b - a
+		}
+		bounds = append(bounds, J)
+	}
+
+	return s[a:b], bounds
+}
+
 // getLine will expand the tabs and color the text between intervals in bnds
+// with color, or the color of their pattern if there are several
 // it also pads out the line with spaces until it is b-a length
-func getLine(s []byte, bnds [][]int, a, b int, color string) string {
-	line, bounds := expandTabs(s, bnds)
+func (st *Style) getLine(s []byte, bnds [][]int, a, b int, color string) string {
+	if len(s) > longLineBytes {
+		// only expand what is in view
+		s, bnds = clip(s, bnds, a, b)
+		a, b = 0, b-a
+	}
+	line, bounds := st.expandTabs(s, bnds)
 	L := len(line)
 
 	if L > b {
@@ -93,10 +144,10 @@ func getLine(s []byte, bnds [][]int, a, b int, color string) string {
 	buf := ""
 	if bounds == nil || len(bounds) == 0 {
 		// all ways the intervals might not exist
-		buf = "\x1b[38;5;244m" + line[a:L] + "\x1b[0m"
+		buf = st.theme.dim + line[a:L] + "\x1b[0m"
 	} else {
 		last := a
-		buf = "\x1b[1m\x1b[38;5;253m"
+		buf = st.theme.text
 
 		for _, I := range bounds {
 			if I[1] <= last {
@@ -114,8 +165,8 @@ func getLine(s []byte, bnds [][]int, a, b int, color string) string {
 				I[1] = L
 			}
 
-			buf += line[last:I[0]] + color
-			buf += line[I[0]:I[1]] + "\x1b[38;5;253m"
+			buf += line[last:I[0]] + st.theme.matchColor(I, color)
+			buf += line[I[0]:I[1]] + "\x1b[0m" + st.theme.text
 			last = I[1]
 
 			if last == L {
@@ -132,24 +183,63 @@ func getLine(s []byte, bnds [][]int, a, b int, color string) string {
 	return buf
 }
 
-func getSplitLine(match []byte, matchIndex [][]int, sub []byte, subIndex [][]int, start, end int, color string) string {
-	w := (end - start) / 2
-	d := (end-start)%2 == 0
+// getSplitLine draws the original line from column start and its
+// substitution from column subStart side by side in width columns
+func (st *Style) getSplitLine(match []byte, matchIndex [][]int, sub []byte, subIndex [][]int, start, subStart, width int) string {
+	w, subW := splitWidths(width)
 
-	line := getLine(match, matchIndex, start, start+w, color)
+	line := st.getLine(match, matchIndex, start, start+w, st.theme.match)
 	line += "\u2502"
+	line += st.getLine(sub, subIndex, subStart, subStart+subW, st.theme.sub)
+	return line
+}
 
-	if d {
-		line += getLine(sub, subIndex, start, start+w-3, color)
-	} else {
-		line += getLine(sub, subIndex, start, start+w-2, color)
+// splitWidths returns the widths of the two sides of a split line
+func splitWidths(width int) (int, int) {
+	return width / 2, width - width/2 - 3
+}
+
+// width returns the number of columns of s once its tabs are expanded,
+// taking each byte as a column like getLine
+func (st *Style) width(s []byte) int {
+	if len(s) > longLineBytes {
+		return len(s)
 	}
-	return line
+
+	n := 0
+	for _, c := range s {
+		if c == '\t' {
+			n += st.tabstop - n%st.tabstop
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// column returns the column byte i of s is shown at, which is past the
+// tabs before it unless s is too long to have them expanded
+func (st *Style) column(s []byte, i int) int {
+	if len(s) > longLineBytes {
+		return i
+	}
+	return st.width(s[:i])
+}
+
+// segments returns the number of rows of w columns that n columns wrap into
+func segments(n, w int) int {
+	if n <= w || w <= 0 {
+		return 1
+	}
+	return (n + w - 1) / w
 }
 
 type Query struct {
-	input string
-	v     int
+	input  string
+	icase  bool
+	invert bool // show the lines that do not match
+	stats  bool // count capture group values
+	v      int
 }
 
 // Terminal acts as the view
@@ -160,29 +250,93 @@ type Terminal struct {
 	mu        sync.Mutex
 
 	hide   bool
-	hideY  int
 	width  int
 	height int
-	posY   int
+	posY   int // first row in view
 	posX   int
-	offset int // cursor offset
+
+	cursor int // row of the selected line
+	match  int // index of the match jumped to on the cursor line, or -1
+	marked map[LineRef]bool
+	pick   bool
+	stats  bool // show the stats panel
+	tail   bool // keep the cursor on the last line as lines are added
+
+	longLines bool // lines start shortly before their first match if it is out of view
+	wrap      bool // long lines continue on the next rows
+	mouse     bool // report clicks and the wheel
+
+	preview       bool    // show the lines around the cursor line
+	previewPos    string  // right or bottom
+	previewOffset int     // rows the preview is scrolled from the cursor line
+	previewRef    LineRef // line the preview was scrolled from
+
+	summary bool         // docs are folded to their headers unless toggled
+	toggled map[int]bool // docs folded or unfolded on their own
+
+	suspended bool      // another program is using the terminal
+	format    *Template // previewed next to the lines if set
+	style     Style
+	bindings  Bindings
+
+	history      *History
+	searching    bool // reverse searching through history
+	search       string
+	searchIdx    int
+	searchFailed bool
+	searchSaved  string // input from before the search started
+
+	going    bool // typing a location to go to
+	goInput  string
+	goFailed bool
 
 	prompt string
+	input  Prompt
 	query  Query
+	and    string // delimiter inserted between patterns
 
 	doc      []*Doc
 	files    int
 	numLines int
+	numBytes int64
+	reading  bool      // the input has not all been read yet
+	warnings []string  // files that could not be read
+	start    time.Time // when reading started
+	spin     int       // spinner frame
 
 	result    *Result
+	cleared   int // version of the last empty query
 	numRes    int
 	displayed bool
 }
 
-func NewTerminal(eb *EventBox) *Terminal {
+func NewTerminal(eb *EventBox, opts *Options) *Terminal {
 	return &Terminal{
-		mainEb: eb,
-		mu:     sync.Mutex{},
+		mainEb:   eb,
+		mu:       sync.Mutex{},
+		marked:   make(map[LineRef]bool),
+		match:    -1,
+		pick:     opts.pick,
+		bindings: opts.bindings,
+		format:   opts.format,
+		style: Style{
+			theme:   opts.theme,
+			tabstop: opts.tabstop,
+		},
+		history:    NewHistory(historyPath(), opts.historySize),
+		query:      Query{invert: opts.invert, stats: opts.stats},
+		stats:      opts.stats,
+		tail:       opts.follow,
+		longLines:  opts.longLines,
+		wrap:       opts.wrap,
+		mouse:      !opts.noMouse,
+		preview:    opts.preview != "",
+		previewPos: opts.preview,
+		summary:    opts.filesWithMatches || opts.filesWithoutMatch || opts.count,
+		toggled:    make(map[int]bool),
+		reading:    true,
+		start:      time.Now(),
+		and:        opts.and,
 	}
 }
 
@@ -191,13 +345,17 @@ func (t *Terminal) fd() int {
 }
 
 func (t *Terminal) Loop() {
-	inChan := make(chan int)
-	winchChan := make(chan os.Signal)
+	inChan := make(chan Key)
+	ackChan := make(chan bool)
+	winchChan := make(chan os.Signal, 1)
 
 	// set up signal for window resize
 	signal.Notify(winchChan, syscall.SIGWINCH)
 
-	go t.getch(inChan)
+	go t.getch(inChan, ackChan)
+
+	ticker := time.NewTicker(spinInterval)
+	defer ticker.Stop()
 
 Loop:
 	for {
@@ -207,400 +365,1729 @@ Loop:
 			t.GetSize()
 			t.Refresh()
 
-		case b := <-inChan:
-			switch b {
-			case KEY_CTRLC, KEY_CTRLD:
-				// Ctrl-C/D quit
+		case <-ticker.C:
+			t.mu.Lock()
+			busy := t.reading || t.searchedChunks() < t.numChunks()
+			if busy {
+				t.spin++
+			}
+			t.mu.Unlock()
+			if busy {
+				t.RefreshPrompt()
+			}
+
+		case in := <-inChan:
+			b := in.key
+			if b == KEY_MOUSE {
+				t.mu.Lock()
+				t.mouseEvent(in.mouse)
+				t.mu.Unlock()
+				t.Refresh()
+				ackChan <- true
+				continue
+			}
+			if t.searching && t.searchKey(b) {
+				ackChan <- true
+				continue
+			}
+			if t.going && t.goKey(b) {
+				ackChan <- true
+				continue
+			}
+
+			switch t.bindings[b] {
+			case ActAbort:
 				t.Close()
 				t.mainEb.Put(EvtQuit, nil)
 				break Loop
 
-			case KEY_ENTER:
-				t.mainEb.Put(EvtSearchFinal, true)
+			case ActAccept:
+				t.history.Append(t.query.input)
+
+				t.mu.Lock()
+				sel := t.selection()
+				t.mu.Unlock()
+				t.mainEb.Put(EvtSearchFinal, sel)
 				break Loop
 
-			case KEY_CTRLJ:
-				if !t.hide {
-					if t.posY+t.height-1 < t.numLines {
-						t.posY++
-						t.Refresh()
-					}
+			case ActCancel:
+				if len(t.query.input) > 0 {
+					t.setQuery("")
 				}
 
-			case KEY_CTRLH:
+			case ActDown:
+				t.mu.Lock()
+				t.moveCursor(1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActUp:
+				t.mu.Lock()
+				t.moveCursor(-1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActPageDown:
+				t.mu.Lock()
+				t.scroll(t.pageRows(1))
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActPageUp:
+				t.mu.Lock()
+				t.scroll(-t.pageRows(-1))
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActScrollLeft:
 				if t.posX > 0 {
 					t.posX--
 					t.Refresh()
 				}
 
-			case KEY_CTRLL:
+			case ActScrollRight:
 				t.posX++
 				t.Refresh()
 
-			case KEY_CTRLK:
-				if !t.hide {
-					if t.posY > 0 {
-						t.posY--
-						t.Refresh()
-					}
-				}
+			case ActToggleHidden:
+				t.mu.Lock()
+				t.toggleHide()
+				t.mu.Unlock()
+				t.Refresh()
 
-			case KEY_CTRLF:
-				if !t.hide {
-					if t.posY+t.height-1 < t.numLines {
-						t.posY += t.height
-						if t.posY+t.height-1 > t.numLines {
-							t.posY = t.numLines - t.height + 1
-						}
-						t.Refresh()
+			case ActToggleMark:
+				t.mu.Lock()
+				if d, line, ok := t.cursorLine(); ok {
+					ref := LineRef{doc: d, line: line}
+					if t.marked[ref] {
+						delete(t.marked, ref)
+					} else {
+						t.marked[ref] = true
 					}
+					t.moveCursor(1)
 				}
+				t.mu.Unlock()
+				t.Refresh()
 
-			case KEY_CTRLB:
-				if !t.hide {
-					if t.posY > 0 {
-						t.posY -= t.height
-						if t.posY < 0 {
-							t.posY = 0
-						}
-						t.Refresh()
-					}
+			case ActToggleCase:
+				t.query.icase = !t.query.icase
+				t.query.v++
+				t.mainEb.Put(EvtSearchNew, t.query)
+				t.RefreshPrompt()
+
+			case ActToggleInvert:
+				t.query.invert = !t.query.invert
+				t.query.v++
+				t.mainEb.Put(EvtSearchNew, t.query)
+				t.RefreshPrompt()
+
+			case ActToggleStats:
+				t.mu.Lock()
+				t.stats = !t.stats
+				t.mu.Unlock()
+				if t.stats && !t.query.stats {
+					// the capture group values are only counted once the
+					// panel has been shown, which takes searching again.
+					// Hiding it keeps them counted so that showing it
+					// again is free.
+					t.query.stats = true
+					t.query.v++
+					t.mainEb.Put(EvtSearchNew, t.query)
 				}
+				t.Refresh()
 
-			case KEY_LEFT:
-				if t.offset < len(t.query.input) {
-					t.offset++
-					t.RefreshPrompt()
-				}
+			case ActToggleFold:
+				t.mu.Lock()
+				t.toggleFold()
+				t.mu.Unlock()
+				t.Refresh()
 
-			case KEY_RIGHT:
-				if t.offset > 0 {
-					t.offset--
-					t.RefreshPrompt()
-				}
+			case ActToggleSummary:
+				t.mu.Lock()
+				t.toggleSummary()
+				t.mu.Unlock()
+				t.Refresh()
 
-			case KEY_CTRLT:
-				t.hide = !t.hide
+			case ActToggleTail:
+				t.mu.Lock()
+				t.tail = !t.tail
+				t.mu.Unlock()
 				t.Refresh()
 
-			case KEY_DEL:
-				if t.offset > 0 && len(t.query.input) > 0 {
-					t.query.v++
-					t.query.input = t.query.input[0:len(t.query.input)-t.offset] + t.query.input[len(t.query.input)-t.offset+1:]
-					t.offset--
-					t.mainEb.Put(EvtSearchNew, t.query)
-					t.RefreshPrompt()
+			case ActFirst:
+				t.mu.Lock()
+				t.tail = false
+				t.match = -1
+				t.cursor = 0
+				t.posY = 0
+				t.fixCursor(1)
+				t.scrollToCursor()
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActLast:
+				t.mu.Lock()
+				t.match = -1
+				t.cursor = t.numRows() - 1
+				t.fixCursor(-1)
+				t.scrollToCursor()
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActGoTo:
+				t.going = true
+				t.goInput = ""
+				t.goFailed = false
+				t.RefreshPrompt()
+
+			case ActNextMatch:
+				t.mu.Lock()
+				t.jumpMatch(1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActPrevMatch:
+				t.mu.Lock()
+				t.jumpMatch(-1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActTogglePreview:
+				t.mu.Lock()
+				t.preview = !t.preview
+				if t.previewPos == "" {
+					t.previewPos = "right"
 				}
+				t.mu.Unlock()
+				t.Refresh()
 
-			case KEY_BACKSPACE:
-				if len(t.query.input) > 0 {
-					if t.offset < len(t.query.input) {
-						t.query.v++
-						t.query.input = t.query.input[0:len(t.query.input)-t.offset-1] + t.query.input[len(t.query.input)-t.offset:]
-						t.mainEb.Put(EvtSearchNew, t.query)
-						t.RefreshPrompt()
-					}
+			case ActPreviewUp:
+				t.mu.Lock()
+				t.scrollPreview(-1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActPreviewDown:
+				t.mu.Lock()
+				t.scrollPreview(1)
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActToggleLongLines:
+				t.mu.Lock()
+				t.longLines = !t.longLines
+				t.posX = 0
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActToggleWrap:
+				t.mu.Lock()
+				t.wrap = !t.wrap
+				t.posX = 0
+				t.mu.Unlock()
+				t.Refresh()
+
+			case ActOpenEditor:
+				t.openEditor()
+
+			case ActHistoryPrev:
+				if q, ok := t.history.Prev(t.query.input); ok {
+					t.setQuery(q)
 				}
 
-			default:
-				if b >= 20 && b <= 126 {
-					t.query.v++
-					// printable chars
-					if t.offset == len(t.query.input) {
-						t.query.input = string(b) + t.query.input
-					} else {
-						t.query.input = t.query.input[0:len(t.query.input)-t.offset] + string(b) + t.query.input[len(t.query.input)-t.offset:]
-					}
-					t.mainEb.Put(EvtSearchNew, t.query)
-					t.RefreshPrompt()
+			case ActHistoryNext:
+				if q, ok := t.history.Next(); ok {
+					t.setQuery(q)
 				}
-			}
-		}
-	}
-}
 
-func (t *Terminal) getch(ch chan<- int) {
-	b := make([]byte, 1)
-	syscall.SetNonblock(t.fd(), false)
+			case ActHistorySearch:
+				t.searching = true
+				t.search = ""
+				t.searchIdx = len(t.history.entries)
+				t.searchFailed = false
+				t.searchSaved = t.query.input
+				t.RefreshPrompt()
 
-	done := false
-	for !done {
-		_, err := syscall.Read(t.fd(), b)
-		if err != nil {
-			panic(t.fd())
-		}
+			case ActBackwardChar:
+				t.input.Left()
+				t.RefreshPrompt()
 
-		if b[0] == KEY_ESC {
-			// escaped
-			syscall.Read(t.fd(), b)
+			case ActForwardChar:
+				t.input.Right()
+				t.RefreshPrompt()
 
-			if b[0] != 91 {
-				// not escape sequence
-				ch <- int(b[0])
-				continue
-			}
+			case ActBeginningOfLine:
+				t.input.Home()
+				t.RefreshPrompt()
 
-			syscall.Read(t.fd(), b)
+			case ActEndOfLine:
+				t.input.End()
+				t.RefreshPrompt()
 
-			if b[0] == 68 {
-				ch <- KEY_LEFT
-			} else if b[0] == 67 {
-				ch <- KEY_RIGHT
-			} else if b[0] == 51 {
-				syscall.Read(t.fd(), b)
-				if b[0] == 126 {
-					ch <- KEY_DEL
-				}
-			}
-		} else {
-			ch <- int(b[0])
+			case ActBackwardWord:
+				t.input.WordLeft()
+				t.RefreshPrompt()
 
-			if int(b[0]) == KEY_CTRLC {
-				done = true
-			}
-		}
-	}
-}
+			case ActForwardWord:
+				t.input.WordRight()
+				t.RefreshPrompt()
 
-// Refresh prints contents
-func (t *Terminal) Refresh() {
-	t.mu.Lock()
+			case ActDeleteChar:
+				t.edited(t.input.Delete())
 
-	var buf strings.Builder
-	buf.WriteString("\x1b[?25l\x1b[H")
+			case ActBackwardDeleteChar:
+				t.edited(t.input.Backspace())
 
-	nrows := 0
+			case ActBackwardKillWord:
+				t.edited(t.input.KillWordBack())
 
-	prevLines := 0
-	d := 0
+			case ActKillWord:
+				t.edited(t.input.KillWordForward())
 
-	posY := t.posY
-	if t.hide {
-		posY = t.hideY
+			case ActUnixWordRubout:
+				t.edited(t.input.KillSpaceBack())
+
+			case ActUnixLineDiscard:
+				t.edited(t.input.KillToStart())
+
+			case ActKillLine:
+				t.edited(t.input.KillToEnd())
+
+			case ActYank:
+				t.edited(t.input.Yank())
+
+			case ActAddPattern:
+				// an empty pattern at the end with the cursor inside of it
+				t.input.End()
+				for _, r := range " " + t.and + " //" {
+					t.input.Insert(r)
+				}
+				t.input.Left()
+				t.edited(true)
+
+			case ActNone:
+				if isPrintable(b) {
+					t.edited(t.input.Insert(rune(b)))
+				}
+			}
+
+			// let getch read the next key
+			ackChan <- true
+		}
 	}
+}
+
+// getch sends keys read from the terminal to ch.  It waits on ack after
+// each key so that nothing is read while another program has the terminal.
+func (t *Terminal) getch(ch chan<- Key, ack <-chan bool) {
+	syscall.SetNonblock(t.fd(), false)
+	r := bufio.NewReader(t.tty)
 
-	// find first relevant doc
 	for {
-		if d >= len(t.doc) {
-			break
-		}
-		if !t.hide && prevLines+t.doc[d].numLines+t.files >= posY {
-			break
-		}
-		if t.hide && (t.result == nil || d >= len(t.result.matchLines) ||
-			prevLines+len(t.result.matchLines[d])+t.files >= posY) {
-			break
+		in, err := readInput(r)
+		if err != nil {
+			panic(t.fd())
 		}
-		if t.hide {
-			prevLines += len(t.result.matchLines[d]) + t.files
-		} else {
-			prevLines += t.doc[d].numLines + t.files
+		if in.key == KEY_UNKNOWN {
+			continue
 		}
-		d++
+
+		ch <- in
+		<-ack
 	}
+}
 
-	if t.files == 1 {
-		if prevLines != posY {
-			// skip filename line
-			prevLines++
-		} else {
-			// print filename
-			buf.WriteString("\x1b[K")
-			buf.WriteString(fileColor)
-			buf.WriteString("******  " + t.doc[d].filename + "  ******\x1b[0m\r\n")
-			nrows++
+// mouseEvent scrolls with the wheel and moves the cursor to the row
+// clicked on.  Clicking a file header folds or unfolds the file, and
+// clicking the gutter of a line marks it.
+func (t *Terminal) mouseEvent(m Mouse) {
+	if t.inPreview(m.x, m.y) {
+		// the wheel scrolls the preview instead
+		if m.button == 64 {
+			t.scrollPreview(-wheelRows)
+		} else if m.button == 65 {
+			t.scrollPreview(wheelRows)
 		}
+		return
 	}
 
-	// XXX: probably better way to do this
-	if !t.hide {
-		ch := (posY - prevLines) / ChunkSize
-		i := posY - prevLines - ch*ChunkSize
-
-		// prints lines in view
-		// d, ch, i have been previously set up
-	Loop:
-		for ; d < len(t.doc); d++ {
-			doc := t.doc[d]
-			for ; ch < len(doc.chunks); ch++ {
-				chunk := doc.chunks[ch]
-
-				for ; i < chunk.num; i++ {
-					buf.WriteString("\x1b[K")
-
-					line := ""
-					if t.result != nil && len(t.result.matchIndex) > d && len(t.result.matchIndex[d].index) > ch {
-						if t.result.output == nil {
-							line = getLine(*chunk.lines[i], t.result.matchIndex[d].index[ch][i], t.posX, t.posX+t.width, matchColor)
-						} else {
-							line = getSplitLine(*chunk.lines[i], t.result.matchIndex[d].index[ch][i], *t.result.output[d][ch*ChunkSize+i],
-								t.result.subIndex[d].index[ch][i], t.posX, t.posX+t.width, matchColor)
-						}
-					} else {
-						// there is no bounds for this
-						if t.result == nil || t.result.output == nil {
-							line = getLine(*chunk.lines[i], nil, t.posX, t.posX+t.width, matchColor)
-						} else {
-							line = getLine(*chunk.lines[i], nil, t.posX, t.posX+t.width, matchColor)
-						}
-					}
-					buf.WriteString(line)
-					buf.WriteString("\r\n")
-					nrows++
+	switch {
+	case m.button == 64:
+		t.scroll(-wheelRows)
 
-					if nrows > t.height-3 {
-						break Loop
-					}
-				}
-				i = 0
+	case m.button == 65:
+		t.scroll(wheelRows)
 
-				if nrows > t.height-3 {
-					break Loop
-				}
-			}
-			ch = 0
-
-			if d != len(t.doc)-1 {
-				buf.WriteString("\x1b[K")
-				buf.WriteString(fileColor)
-				buf.WriteString("******  " + t.doc[d+1].filename + "  ******\x1b[0m\r\n")
-				nrows++
-				if nrows > t.height-3 {
-					break Loop
-				}
-			}
+	case m.button == 0 && !m.release:
+		if m.y >= t.viewHeight() {
+			return
+		}
+		r, ok := t.rowAt(m.y)
+		if !ok {
+			return
 		}
-	} else {
-		i := posY - prevLines
-
-		// prints matches in view
-		// d, i have been previously set up
-	Loop2:
-		for ; d < len(t.doc); d++ {
-			if t.result != nil && d < len(t.result.matchLines) {
-				matches := t.result.matchLines[d]
-				for ; i < len(matches); i++ {
-					ch := matches[i] / ChunkSize
-					j := matches[i] % ChunkSize
-					chunk := t.doc[d].chunks[ch]
-
-					buf.WriteString("\x1b[K")
-
-					line := getLine(*chunk.lines[j], t.result.matchIndex[d].index[ch][j], t.posX, t.posX+t.width, matchColor)
-					buf.WriteString(line)
-					buf.WriteString("\r\n")
-					nrows++
-
-					if nrows > t.height-3 {
-						break Loop2
-					}
-				}
-				i = 0
-			}
-
-			if nrows > t.height-3 {
-				break Loop2
-			}
 
-			if d != len(t.doc)-1 {
-				buf.WriteString("\x1b[K")
-				buf.WriteString(fileColor)
-				buf.WriteString("******  " + t.doc[d+1].filename + "  ******\x1b[0m\r\n")
-				nrows++
-				if nrows > t.height-3 {
-					break Loop2
-				}
+		t.tail = false
+		t.match = -1
+		t.cursor = r
+		if d, k, _ := t.locate(r); k < 0 {
+			t.toggleFold()
+		} else if m.x < gutterWidth {
+			ref := LineRef{doc: d, line: t.lineAt(d, k)}
+			if t.marked[ref] {
+				delete(t.marked, ref)
+			} else {
+				t.marked[ref] = true
 			}
 		}
 	}
+}
 
-	for j := nrows; j < t.height-1; j++ {
-		buf.WriteString("\x1b[K\r\n")
+// edited updates the query after the prompt has been edited
+func (t *Terminal) edited(changed bool) {
+	if changed {
+		t.query.v++
+		t.query.input = t.input.String()
+		t.mainEb.Put(EvtSearchNew, t.query)
 	}
-	buf.WriteString("\x1b[?25h")
-	fmt.Fprint(os.Stderr, buf.String())
-
-	t.mu.Unlock()
+	t.RefreshPrompt()
+}
 
+// setQuery replaces the prompt input and starts a new search
+func (t *Terminal) setQuery(s string) {
+	t.input.SetText(s)
+	t.query.v++
+	t.query.input = s
+	t.mainEb.Put(EvtSearchNew, t.query)
 	t.RefreshPrompt()
 }
 
-// RefreshPrompt refreshes just the prompt line
-func (t *Terminal) RefreshPrompt() {
-	t.mu.Lock()
-	buf := "\x1b[G\x1b[F"
+// searchKey handles key b during a reverse history search.  It returns
+// false if the search has ended and b should be handled as usual.
+func (t *Terminal) searchKey(b int) bool {
+	switch act := t.bindings[b]; {
+	case act == ActHistorySearch:
+		// look further back
+		t.searchFrom(t.searchIdx - 1)
+
+	case act == ActCancel:
+		// restore the original input
+		t.searching = false
+		t.setQuery(t.searchSaved)
+
+	case act == ActAccept:
+		// keep the found query
+		t.searching = false
+		t.RefreshPrompt()
 
-	if t.doc == nil {
-		buf += "\r\n"
-	} else {
-		matchCount := t.numLines
-		if t.result != nil && t.result.matchLines != nil {
-			matchCount = 0
-			for _, x := range t.result.matchLines {
-				matchCount += len(x)
-			}
+	case act == ActBackwardDeleteChar:
+		if r := []rune(t.search); len(r) > 0 {
+			t.search = string(r[:len(r)-1])
+			t.searchFrom(len(t.history.entries) - 1)
 		}
-		buf += fmt.Sprintf("\x1b[37;1m%d\x1b[31;1m/\x1b[37;1m%d\x1b[0m\r\n", matchCount, t.numLines)
+
+	case act == ActNone && isPrintable(b):
+		t.search += string(rune(b))
+		t.searchFrom(t.searchIdx)
+
+	default:
+		t.searching = false
+		t.RefreshPrompt()
+		return false
 	}
 
-	buf += "\x1b[31;1m> \x1b[0m\x1b[37;1m"
+	return true
+}
 
-	if len(t.prompt) > 0 {
-		buf += t.prompt + " "
+// goKey handles key b while typing a location to go to.  It returns false
+// if the prompt has been left and b should be handled as usual.
+func (t *Terminal) goKey(b int) bool {
+	switch act := t.bindings[b]; {
+	case act == ActCancel:
+		t.going = false
+		t.RefreshPrompt()
+
+	case act == ActAccept:
+		t.mu.Lock()
+		ok := t.goTo(t.goInput)
+		t.mu.Unlock()
+		t.going = !ok
+		t.goFailed = !ok
+		t.Refresh()
+
+	case act == ActBackwardDeleteChar:
+		if r := []rune(t.goInput); len(r) > 0 {
+			t.goInput = string(r[:len(r)-1])
+		}
+		t.goFailed = false
+		t.RefreshPrompt()
+
+	case act == ActNone && isPrintable(b):
+		t.goInput += string(rune(b))
+		t.goFailed = false
+		t.RefreshPrompt()
+
+	default:
+		t.going = false
+		t.RefreshPrompt()
+		return false
 	}
 
-	buf += t.query.input + "\x1b[K\x1b[0m"
-	if t.offset > 0 {
-		// set cursor
-		buf += "\x1b[" + strconv.Itoa(t.offset) + "D"
+	return true
+}
+
+// isPrintable returns whether key b is a character to insert
+func isPrintable(b int) bool {
+	return b >= 32 && b <= utf8.MaxRune && b != KEY_BACKSPACE
+}
+
+// searchFrom finds the newest history entry at or before i containing the search string
+func (t *Terminal) searchFrom(i int) {
+	j := t.history.Search(t.search, i)
+	if j < 0 {
+		t.searchFailed = true
+		t.RefreshPrompt()
+		return
 	}
 
-	fmt.Fprint(os.Stderr, buf)
-	t.mu.Unlock()
+	t.searchIdx = j
+	t.searchFailed = false
+	t.setQuery(t.history.entries[j])
 }
 
-func (t *Terminal) ClearBounds() {
+// openEditor suspends the display and opens the line under the cursor in $EDITOR
+func (t *Terminal) openEditor() {
 	t.mu.Lock()
-	t.result = nil
+	name := ""
+	d, line, ok := t.cursorLine()
+	if ok {
+		name = t.doc[d].filename
+	}
 	t.mu.Unlock()
-	t.Refresh()
-}
 
-func (t *Terminal) UpdateBounds(x *Result) {
-	t.mu.Lock()
+	if name == "" {
+		// nothing selected or reading from stdin
+		return
+	}
 
-	if t.result == nil || x.v > t.result.v {
-		t.displayed = false
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
 	}
-	t.result = x
 
-	refresh := false
+	// the editor needs the terminal even if stdout is a pipe
+	tty, err := os.OpenFile(console, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	defer tty.Close()
 
-	// refresh the display if got a new version of result and got enough chunks
-	if !t.displayed {
-		n := len(t.result.matchIndex) - 1
-		numLines := 0
+	args := append(editor[1:], "+"+strconv.Itoa(line+1), name)
+	cmd := exec.Command(editor[0], args...)
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
 
-		for d := 0; d < len(t.result.matchIndex); d++ {
-			if len(t.result.matchIndex[d].index) == len(t.doc[d].chunks) {
-				numLines += t.doc[d].numLines + t.files
-			} else {
-				numLines += t.files + len(t.result.matchIndex[d].index)*ChunkSize
-			}
-		}
+	t.Suspend()
+	cmd.Run()
+	t.Resume()
+}
 
-		if (len(t.result.matchIndex) == len(t.doc) && len(t.result.matchIndex[n].index) == len(t.doc[n].chunks)) ||
-			numLines > t.posY+t.height {
-			t.displayed = true
-			refresh = true
-		}
-	}
+// viewHeight is the number of rows available for displaying lines
+func (t *Terminal) viewHeight() int {
+	return t.height - 2 - t.statsHeight() - t.warningsHeight() - t.previewRows()
+}
 
-	t.mu.Unlock()
-	if refresh || t.hide {
-		t.Refresh()
+// previewRows is the number of rows of the preview pane below the lines
+func (t *Terminal) previewRows() int {
+	if !t.preview || t.previewPos != "bottom" {
+		return 0
 	}
-	t.RefreshPrompt()
+	return (t.height - 2 - t.statsHeight() - t.warningsHeight()) / 2
+}
+
+// listWidth is the number of columns for the lines, which are next to
+// the preview pane if it is on the right
+func (t *Terminal) listWidth() int {
+	if !t.preview || t.previewPos != "right" {
+		return t.width
+	}
+	return t.width / 2
+}
+
+// inPreview returns whether column x of row y is in the preview pane
+func (t *Terminal) inPreview(x, y int) bool {
+	if !t.preview {
+		return false
+	}
+	if t.previewPos == "right" {
+		return x >= t.listWidth() && y < t.viewHeight()
+	}
+	return y >= t.viewHeight() && y < t.viewHeight()+t.previewRows()
+}
+
+// previewLine returns the doc and line the preview is centered on
+func (t *Terminal) previewLine() (int, int, bool) {
+	d, line, ok := t.cursorLine()
+	if !ok {
+		// a file header, so start at the first line
+		d, _, ok = t.locate(t.cursor)
+		line = 0
+	}
+	return d, line, ok
+}
+
+// previewStart returns the first line of doc d in a preview of h rows
+// around line, scrolled by offset rows but kept within the doc
+func (t *Terminal) previewStart(d, line, offset, h int) int {
+	n := h - 1
+	start := line - n/2 + offset
+	if start > t.doc[d].numLines-n {
+		start = t.doc[d].numLines - n
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start
+}
+
+// scrollPreview scrolls the preview by n rows.  The offset only applies
+// to the line it was scrolled from, so it is reset once the cursor moves.
+func (t *Terminal) scrollPreview(n int) {
+	d, line, ok := t.previewLine()
+	if !ok {
+		return
+	}
+	if ref := (LineRef{doc: d, line: line}); ref != t.previewRef {
+		t.previewRef = ref
+		t.previewOffset = 0
+	}
+
+	h := t.viewHeight()
+	if t.previewPos == "bottom" {
+		h = t.previewRows()
+	}
+	// the offset as shown, since the view might have been clamped
+	mid := line - (h-1)/2
+	offset := t.previewStart(d, line, t.previewOffset, h) - mid
+	t.previewOffset = t.previewStart(d, line, offset+n, h) - mid
+}
+
+// previewPanel returns h rows of w columns with the lines around the
+// cursor line in its doc, after a row with the file name and line number
+func (t *Terminal) previewPanel(h, w int) []string {
+	rows := make([]string, 0, h)
+	th := t.style.theme
+
+	d, line, ok := t.previewLine()
+	if ok && h > 0 {
+		doc := t.doc[d]
+		offset := 0
+		if (LineRef{doc: d, line: line}) == t.previewRef {
+			offset = t.previewOffset
+		}
+
+		title := fmt.Sprintf("line %d", line+1)
+		if doc.filename != "" {
+			title = fmt.Sprintf("%s:%d", doc.filename, line+1)
+		}
+		rows = append(rows, th.file+t.style.truncate(title, w)+"\x1b[0m")
+
+		// the cursor line in the middle, unless the preview is scrolled
+		n := h - 1
+		start := t.previewStart(d, line, offset, h)
+
+		numW := len(strconv.Itoa(doc.numLines))
+		for l := start; l < start+n && l < doc.numLines && w > numW+1; l++ {
+			num := th.dim
+			bounds := t.lineBounds(d, l)
+			if l == line {
+				num = th.cursor
+				bounds = t.emphasize(bounds)
+			}
+			num += fmt.Sprintf("%*d ", numW, l+1) + "\x1b[0m"
+			rows = append(rows, num+t.style.getLine(doc.line(l), bounds, 0, w-numW-1, th.match))
+		}
+	}
+
+	for len(rows) < h {
+		rows = append(rows, "")
+	}
+	return rows
+}
+
+// warningsHeight is the number of rows of warnings
+func (t *Terminal) warningsHeight() int {
+	if len(t.warnings) > warningRows {
+		return warningRows
+	}
+	return len(t.warnings)
+}
+
+// warningsPanel returns the rows of warnings, the last one saying how
+// many more there are if they do not fit
+func (t *Terminal) warningsPanel() []string {
+	rows := make([]string, 0, warningRows)
+	for i, w := range t.warnings {
+		if i == warningRows-1 && len(t.warnings) > warningRows {
+			w = fmt.Sprintf("and %d more files could not be read", len(t.warnings)-i)
+		}
+		rows = append(rows, t.style.theme.warning+"! "+t.style.truncate(w, t.width-2)+"\x1b[0m")
+		if len(rows) == warningRows {
+			break
+		}
+	}
+	return rows
+}
+
+// statsHeight is the number of rows of the stats panel
+func (t *Terminal) statsHeight() int {
+	if !t.stats {
+		return 0
+	}
+	return statsRows + 1
+}
+
+// folded returns whether doc d is collapsed to its header
+func (t *Terminal) folded(d int) bool {
+	return t.files == 1 && t.summary != t.toggled[d]
+}
+
+// docLines returns the number of lines of doc d shown in the current view
+func (t *Terminal) docLines(d int) int {
+	if t.folded(d) {
+		return 0
+	}
+	if !t.hide {
+		return t.doc[d].numLines
+	}
+	if t.result == nil || d >= len(t.result.matchLines) {
+		return 0
+	}
+	return len(t.result.matchLines[d])
+}
+
+// numRows returns the number of rows in the current view, including file headers
+func (t *Terminal) numRows() int {
+	n := 0
+	for d := range t.doc {
+		n += t.files + t.docLines(d)
+	}
+	return n
+}
+
+// lineAt returns the line number in doc d of the k-th line shown in the current view
+func (t *Terminal) lineAt(d, k int) int {
+	if t.hide {
+		return t.result.matchLines[d][k]
+	}
+	return k
+}
+
+// locate returns the doc of row r and the index of r among the doc's shown lines.
+// The index is -1 if r is a file header.
+func (t *Terminal) locate(r int) (int, int, bool) {
+	if r < 0 {
+		return 0, 0, false
+	}
+	for d := range t.doc {
+		n := t.files + t.docLines(d)
+		if r < n {
+			return d, r - t.files, true
+		}
+		r -= n
+	}
+	return 0, 0, false
+}
+
+// rowOf returns the row of line in doc d in the current view.  If the line
+// is not shown, the row of the next shown line is returned instead.
+func (t *Terminal) rowOf(d, line int) int {
+	r := 0
+	for e := 0; e < d && e < len(t.doc); e++ {
+		r += t.files + t.docLines(e)
+	}
+
+	k := line
+	if t.hide {
+		k = 0
+		if t.result != nil && d < len(t.result.matchLines) {
+			k = sort.SearchInts(t.result.matchLines[d], line)
+		}
+	}
+
+	return r + t.files + k
+}
+
+// cursorLine returns the doc and line under the cursor
+func (t *Terminal) cursorLine() (int, int, bool) {
+	d, k, ok := t.locate(t.cursor)
+	if !ok || k < 0 {
+		return 0, 0, false
+	}
+	return d, t.lineAt(d, k), true
+}
+
+// fixCursor keeps the cursor on a line of the view, moving it
+// off of file headers of unfolded docs in direction dir if needed
+func (t *Terminal) fixCursor(dir int) {
+	n := t.numRows()
+	if t.cursor >= n {
+		t.cursor = n - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+
+	for _, step := range []int{dir, -dir} {
+		for c := t.cursor; c >= 0 && c < n; c += step {
+			if d, k, _ := t.locate(c); k >= 0 || t.folded(d) {
+				t.cursor = c
+				return
+			}
+		}
+	}
+}
+
+// maxPosY returns the first row in view when the view is at the end
+func (t *Terminal) maxPosY() int {
+	max := t.numRows() - t.viewHeight()
+	if t.wrap {
+		max = t.numRows() - t.fitRows(t.numRows()-1, -1)
+	}
+	if max < 0 {
+		max = 0
+	}
+	return max
+}
+
+// scrollToCursor moves the view so that the cursor is visible
+func (t *Terminal) scrollToCursor() {
+	if max := t.maxPosY(); t.posY > max {
+		t.posY = max
+	}
+
+	if t.cursor < t.posY {
+		t.posY = t.cursor
+		if _, k, _ := t.locate(t.cursor); k == 0 {
+			// show the file header too
+			t.posY -= t.files
+		}
+	} else if t.cursor >= t.posY+t.viewHeight() {
+		t.posY = t.cursor - t.viewHeight() + 1
+	}
+
+	if t.wrap {
+		// the rows up to the cursor might wrap past the bottom
+		h := 0
+		for r := t.posY; r <= t.cursor; r++ {
+			h += t.rowHeight(r)
+		}
+		for ; h > t.viewHeight() && t.posY < t.cursor; t.posY++ {
+			h -= t.rowHeight(t.posY)
+		}
+	}
+}
+
+// rowAt returns the row shown on screen row y of the view
+func (t *Terminal) rowAt(y int) (int, bool) {
+	for r, rows := t.posY, t.numRows(); r < rows; r++ {
+		y -= t.rowHeight(r)
+		if y < 0 {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// rowHeight returns the number of screen rows row r takes up
+func (t *Terminal) rowHeight(r int) int {
+	d, k, ok := t.locate(r)
+	if !t.wrap || !ok || k < 0 {
+		return 1
+	}
+	return t.lineSegments(d, t.lineAt(d, k))
+}
+
+// fitRows returns the number of rows from row r on in direction dir that
+// fit on the screen, which is at least one
+func (t *Terminal) fitRows(r, dir int) int {
+	n, h := 0, 0
+	for rows := t.numRows(); r >= 0 && r < rows; r += dir {
+		h += t.rowHeight(r)
+		if h > t.viewHeight() {
+			break
+		}
+		n++
+	}
+
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// pageRows returns the number of rows to scroll a page in direction dir
+func (t *Terminal) pageRows(dir int) int {
+	if !t.wrap {
+		return t.viewHeight()
+	}
+	if dir > 0 {
+		return t.fitRows(t.posY, 1)
+	}
+	return t.fitRows(t.posY-1, -1)
+}
+
+// moveCursor moves the cursor n lines.  Moving up stops following the
+// last line.
+func (t *Terminal) moveCursor(n int) {
+	dir := 1
+	if n < 0 {
+		dir = -1
+		t.tail = false
+	}
+
+	t.cursor += n
+	t.match = -1
+	t.fixCursor(dir)
+	t.scrollToCursor()
+}
+
+// goTo moves the cursor to the location in s and shows it at the top of
+// the view.  s is a line number in the doc under the cursor, the name of a
+// file or part of one, or both as file:line.  In hide mode the cursor goes
+// to the next shown line of the doc, or its last one.  It returns false if
+// there is no such location.
+func (t *Terminal) goTo(s string) bool {
+	if len(t.doc) == 0 {
+		return false
+	}
+
+	name, num := "", s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		name, num = s[:i], s[i+1:]
+	} else if _, err := strconv.Atoi(s); err != nil {
+		name, num = s, ""
+	}
+
+	d, _, _ := t.locate(t.cursor)
+	if name != "" {
+		d = -1
+		for e, doc := range t.doc {
+			if strings.Contains(doc.filename, name) {
+				d = e
+				break
+			}
+		}
+		if d < 0 {
+			return false
+		}
+	}
+
+	line := 0
+	if num != "" {
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 1 {
+			return false
+		}
+		line = n - 1
+		if line >= t.doc[d].numLines {
+			line = t.doc[d].numLines - 1
+		}
+	}
+
+	if t.hide && (t.result == nil || d >= len(t.result.matchLines) || len(t.result.matchLines[d]) == 0) {
+		// every line of the doc is hidden
+		return false
+	}
+
+	if t.folded(d) {
+		t.toggled[d] = !t.toggled[d]
+	}
+	t.tail = false
+	t.match = -1
+
+	// the next shown line, but no further than the last one of the doc
+	t.cursor = t.rowOf(d, line)
+	if last := t.rowOf(d, 0) + t.docLines(d) - 1; t.cursor > last {
+		t.cursor = last
+	}
+	t.fixCursor(1)
+
+	// the view starts at the line, or at its file header if it is the first
+	t.posY = t.cursor
+	if _, k, _ := t.locate(t.cursor); k == 0 {
+		t.posY -= t.files
+	}
+	t.scrollToCursor()
+	return true
+}
+
+// jumpMatch moves the cursor to the next match in direction dir, going
+// through the matches of the cursor line before moving to the next
+// matching line and wrapping around from the last doc to the first
+func (t *Terminal) jumpMatch(dir int) {
+	if t.result == nil || len(t.result.matchLines) == 0 {
+		return
+	}
+
+	d, line, ok := t.cursorLine()
+	if !ok {
+		// on a file header, so start before the doc's first line
+		d, _, _ = t.locate(t.cursor)
+		line = -1
+		if dir < 0 {
+			line = t.doc[d].numLines
+		}
+	}
+
+	if ok {
+		if m := t.match + dir; m >= 0 && m < len(t.lineBounds(d, line)) && (t.match >= 0 || dir > 0) {
+			t.match = m
+			t.showMatch(d, line)
+			return
+		}
+	}
+
+	n := len(t.result.matchLines)
+	if d >= n {
+		// the docs from the cursor doc on have not been searched yet, so
+		// start from the first doc going down or the last searched one
+		// going up
+		d, line = 0, -1
+		if dir < 0 {
+			d, line = n-1, t.doc[n-1].numLines
+		}
+	}
+	for i := 0; i <= n; i++ {
+		e := ((d+dir*i)%n + n) % n
+		ml := t.result.matchLines[e]
+		if len(ml) == 0 {
+			continue
+		}
+
+		// the lines after the cursor line or, further on, all of them
+		k := 0
+		if dir < 0 {
+			k = len(ml) - 1
+		}
+		if i == 0 {
+			k = sort.SearchInts(ml, line+1)
+			if dir < 0 {
+				k = sort.SearchInts(ml, line) - 1
+			}
+			if k < 0 || k >= len(ml) {
+				continue
+			}
+		}
+
+		if t.folded(e) {
+			t.toggled[e] = !t.toggled[e]
+		}
+		t.tail = false
+		t.cursor = t.rowOf(e, ml[k])
+		t.match = 0
+		if dir < 0 {
+			t.match = len(t.lineBounds(e, ml[k])) - 1
+		}
+		t.scrollToCursor()
+		t.showMatch(e, ml[k])
+		return
+	}
+}
+
+// lineBounds returns the bounds of the matches on line of doc d
+func (t *Terminal) lineBounds(d, line int) [][]int {
+	ch := line / ChunkSize
+	if t.result == nil || len(t.result.matchIndex) <= d || len(t.result.matchIndex[d].index) <= ch {
+		return nil
+	}
+	return t.result.matchIndex[d].index[ch][line%ChunkSize]
+}
+
+// showMatch scrolls sideways so that the match jumped to on line of doc d
+// is in view
+func (t *Terminal) showMatch(d, line int) {
+	bounds := t.lineBounds(d, line)
+	if t.wrap || t.match < 0 || t.match >= len(bounds) {
+		return
+	}
+
+	w := t.listWidth() - gutterWidth
+	if _, _, _, _, split := t.lineParts(d, line); split {
+		w, _ = splitWidths(w)
+	}
+
+	s := t.doc[d].line(line)
+	start, end := t.style.column(s, bounds[t.match][0]), t.style.column(s, bounds[t.match][1])
+	x := t.posX + t.lineOffset(s, bounds, w)
+	if start < x || end > x+w {
+		t.posX = start - w/4 - t.lineOffset(s, bounds, w)
+		if t.posX < 0 {
+			t.posX = 0
+		}
+	}
+}
+
+// scroll moves both the view and the cursor n rows
+func (t *Terminal) scroll(n int) {
+	t.posY += n
+	if t.posY < 0 {
+		t.posY = 0
+	}
+	if !t.wrap {
+		t.moveCursor(n)
+		return
+	}
+
+	// rows take up different heights, so the cursor is kept in the new
+	// view rather than the view following the cursor back
+	if max := t.maxPosY(); t.posY > max {
+		t.posY = max
+	}
+	t.cursor += n
+	if last := t.posY + t.fitRows(t.posY, 1) - 1; t.cursor > last {
+		t.cursor = last
+	}
+	if t.cursor < t.posY {
+		t.cursor = t.posY
+	}
+	t.moveCursor(0)
+	if n < 0 {
+		t.tail = false
+	}
+}
+
+// toggleHide switches between showing all lines and only matches,
+// keeping the cursor on the same line if possible
+func (t *Terminal) toggleHide() {
+	d, line, ok := t.cursorLine()
+	offset := t.cursor - t.posY
+
+	t.hide = !t.hide
+
+	if ok {
+		t.cursor = t.rowOf(d, line)
+	}
+	t.fixCursor(1)
+	t.posY = t.cursor - offset
+	if t.posY < 0 {
+		t.posY = 0
+	}
+	t.scrollToCursor()
+}
+
+// toggleFold folds or unfolds the doc under the cursor
+func (t *Terminal) toggleFold() {
+	d, _, ok := t.locate(t.cursor)
+	if !ok || t.files == 0 {
+		return
+	}
+
+	t.toggled[d] = !t.toggled[d]
+	t.cursor = t.rowOf(d, 0) - t.files
+	t.fixCursor(1)
+	t.scrollToCursor()
+}
+
+// toggleSummary folds or unfolds every doc, keeping the cursor on the
+// same doc
+func (t *Terminal) toggleSummary() {
+	d, line, ok := t.cursorLine()
+	if !ok {
+		d, _, ok = t.locate(t.cursor)
+		line = 0
+	}
+
+	t.summary = !t.summary
+	t.toggled = make(map[int]bool)
+
+	if ok {
+		t.cursor = t.rowOf(d, line)
+		if t.summary {
+			t.cursor = t.rowOf(d, 0) - t.files
+		}
+	}
+	t.fixCursor(1)
+	t.scrollToCursor()
+}
+
+// selection returns the lines to output, or nil if all the matches should be
+func (t *Terminal) selection() []LineRef {
+	if len(t.marked) > 0 {
+		sel := make([]LineRef, 0, len(t.marked))
+		for ref := range t.marked {
+			sel = append(sel, ref)
+		}
+		sort.Slice(sel, func(i, j int) bool {
+			if sel[i].doc != sel[j].doc {
+				return sel[i].doc < sel[j].doc
+			}
+			return sel[i].line < sel[j].line
+		})
+		return sel
+	}
+
+	if !t.pick {
+		return nil
+	}
+
+	sel := make([]LineRef, 0, 1)
+	if d, line, ok := t.cursorLine(); ok {
+		sel = append(sel, LineRef{doc: d, line: line})
+	}
+	return sel
+}
+
+// header returns the file header of doc d with its number of lines
+func (t *Terminal) header(d int, cursor bool) string {
+	th := t.style.theme
+	h := th.file + "******  " + t.doc[d].filename + "  ******\x1b[0m"
+	if cursor {
+		h = th.cursor + ">\x1b[0m " + th.file + "****  " + t.doc[d].filename + "  ******\x1b[0m"
+	}
+
+	count := fmt.Sprintf("%d lines", t.doc[d].numLines)
+	if t.result != nil && d < len(t.result.matchLines) {
+		count = fmt.Sprintf("%d matching lines", len(t.result.matchLines[d]))
+	}
+	h += "  " + th.dim + count
+	if t.folded(d) {
+		h += " [+]"
+	}
+	return h + "\x1b[0m"
+}
+
+// gutter returns the cursor and mark columns in front of a line
+func (t *Terminal) gutter(d, line int, cursor bool) string {
+	g := " "
+	if cursor {
+		g = t.style.theme.cursor + ">\x1b[0m"
+	}
+	if t.marked[LineRef{doc: d, line: line}] {
+		g += t.style.theme.marker + "*\x1b[0m"
+	} else {
+		g += " "
+	}
+	return g
+}
+
+// continuation returns the gutter in front of the wrapped rows of a line
+func (t *Terminal) continuation() string {
+	return " " + t.style.theme.dim + "\u21aa\x1b[0m"
+}
+
+// lineParts returns line of doc d with the bounds of its matches and, if
+// it is shown next to its substitution or format preview, those as well
+func (t *Terminal) lineParts(d, line int) ([]byte, [][]int, []byte, [][]int, bool) {
+	ch := line / ChunkSize
+	i := line % ChunkSize
+	s := *t.doc[d].chunks[ch].lines[i]
+
+	if t.result == nil || len(t.result.matchIndex) <= d || len(t.result.matchIndex[d].index) <= ch {
+		// there is no bounds for this
+		return s, nil, nil, nil, false
+	}
+
+	bounds := t.result.matchIndex[d].index[ch][i]
+	if t.format != nil && t.result.prog != nil {
+		sub, subBounds := t.formatPreview(d, line, s)
+		return s, bounds, sub, subBounds, true
+	}
+	if !t.hide && t.result.output != nil && line < len(t.result.output[d]) {
+		return s, bounds, *t.result.output[d][line], t.result.subIndex[d].index[ch][i], true
+	}
+	return s, bounds, nil, nil, false
+}
+
+// lineSegments returns the number of rows line of doc d wraps into, which
+// is at most the height of the view
+func (t *Terminal) lineSegments(d, line int) int {
+	if !t.wrap {
+		return 1
+	}
+
+	w := t.listWidth() - gutterWidth
+	s, _, sub, _, split := t.lineParts(d, line)
+
+	n := segments(t.style.width(s), w)
+	if split {
+		w, subW := splitWidths(w)
+		n = segments(t.style.width(s), w)
+		if m := segments(t.style.width(sub), subW); m > n {
+			n = m
+		}
+	}
+
+	if n > t.viewHeight() {
+		n = t.viewHeight()
+	}
+	return n
+}
+
+// emphasize returns the bounds of the cursor line with the match jumped
+// to marked
+func (t *Terminal) emphasize(bounds [][]int) [][]int {
+	if t.match < 0 || t.match >= len(bounds) {
+		return bounds
+	}
+
+	res := append([][]int{}, bounds...)
+	b := bounds[t.match]
+	pattern := 0
+	if len(b) > 2 {
+		pattern = b[2]
+	}
+	res[t.match] = []int{b[0], b[1], pattern, 1}
+	return res
+}
+
+// renderLine returns the rows of line of doc d with the matches
+// highlighted in w columns, which is one row unless lines are wrapped.
+// The match jumped to is emphasized on the cursor line.
+func (t *Terminal) renderLine(d, line, w int, cursor bool) []string {
+	s, bounds, sub, subBounds, split := t.lineParts(d, line)
+	if cursor {
+		bounds = t.emphasize(bounds)
+	}
+	n := t.lineSegments(d, line)
+	rows := make([]string, n)
+
+	if split {
+		lw, subW := splitWidths(w)
+		x, subX := t.posX+t.lineOffset(s, bounds, lw), t.posX+t.lineOffset(sub, subBounds, subW)
+		for i := range rows {
+			if t.wrap {
+				x, subX = i*lw, i*subW
+			}
+			rows[i] = t.style.getSplitLine(s, bounds, sub, subBounds, x, subX, w)
+		}
+		return rows
+	}
+
+	x := t.posX + t.lineOffset(s, bounds, w)
+	for i := range rows {
+		if t.wrap {
+			x = i * w
+		}
+		rows[i] = t.style.getLine(s, bounds, x, x+w, t.style.theme.match)
+	}
+	return rows
+}
+
+// lineOffset returns the column line s with the matches in bounds starts
+// from in long-line mode, so that its first match is in view of w columns
+func (t *Terminal) lineOffset(s []byte, bounds [][]int, w int) int {
+	if !t.longLines || len(bounds) == 0 || t.style.column(s, bounds[0][1]) <= w {
+		return 0
+	}
+	if x := t.style.column(s, bounds[0][0]) - w/4; x > 0 {
+		return x
+	}
+	return 0
+}
+
+// formatPreview returns the format template applied to each match of
+// line s of doc d, along with the bounds of each expansion
+func (t *Terminal) formatPreview(d, line int, s []byte) ([]byte, [][]int) {
+	res := make([]byte, 0)
+	bounds := make([][]int, 0)
+
+	for i, m := range t.result.prog.FindSubmatch(s) {
+		if i > 0 {
+			res = append(res, "  "...)
+		}
+		start := len(res)
+		res = t.format.Expand(res, m.re, s, m.index, t.doc[d].filename, line)
+		bounds = append(bounds, []int{start, len(res)})
+	}
+
+	return res, bounds
+}
+
+// Refresh prints contents
+func (t *Terminal) Refresh() {
+	t.mu.Lock()
+	if t.suspended {
+		t.mu.Unlock()
+		return
+	}
+
+	var buf strings.Builder
+	buf.WriteString("\x1b[?25l\x1b[H")
+
+	if t.tail {
+		t.cursor = t.numRows() - 1
+		t.fixCursor(-1)
+	}
+	t.fixCursor(1)
+	t.scrollToCursor()
+
+	rows := make([]string, 0, t.viewHeight())
+	d, k, ok := t.locate(t.posY)
+
+	// rows in view, which can take up several screen rows when wrapped
+	for r := t.posY; ok && len(rows) < t.viewHeight(); r++ {
+		if k < 0 {
+			rows = append(rows, t.header(d, r == t.cursor))
+		} else {
+			line := t.lineAt(d, k)
+			for i, row := range t.renderLine(d, line, t.listWidth()-gutterWidth, r == t.cursor) {
+				if len(rows) == t.viewHeight() {
+					break
+				}
+				g := t.continuation()
+				if i == 0 {
+					g = t.gutter(d, line, r == t.cursor)
+				}
+				rows = append(rows, g+row)
+			}
+		}
+
+		// advance to the next row, skipping docs with nothing to show
+		for k++; ok && k >= t.docLines(d); k = -t.files {
+			d++
+			ok = d < len(t.doc)
+			if !ok {
+				break
+			}
+		}
+	}
+
+	for len(rows) < t.viewHeight() {
+		rows = append(rows, "")
+	}
+
+	if t.preview && t.previewPos == "right" {
+		// the preview pane overwrites the end of rows that are too long
+		w := t.listWidth()
+		preview := t.previewPanel(len(rows), t.width-w-1)
+		for i := range rows {
+			rows[i] += fmt.Sprintf("\x1b[%dG", w+1) + t.style.theme.prompt + "\u2502\x1b[0m" + preview[i]
+		}
+	}
+	for _, row := range rows {
+		buf.WriteString("\x1b[K" + row + "\x1b[K\r\n")
+	}
+	for _, row := range t.previewPanel(t.previewRows(), t.width) {
+		buf.WriteString("\x1b[K" + row + "\r\n")
+	}
+	for _, row := range t.warningsPanel() {
+		buf.WriteString("\x1b[K" + row + "\r\n")
+	}
+	for _, row := range t.statsPanel() {
+		buf.WriteString("\x1b[K" + row + "\r\n")
+	}
+	buf.WriteString("\x1b[K\r\n\x1b[?25h")
+	fmt.Fprint(os.Stderr, buf.String())
+
+	t.mu.Unlock()
+
+	t.RefreshPrompt()
+}
+
+// RefreshStats refreshes just the stats panel
+func (t *Terminal) RefreshStats() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.suspended || !t.stats {
+		return
+	}
+
+	buf := fmt.Sprintf("\x1b[?25l\x1b[%d;1H", t.viewHeight()+t.previewRows()+t.warningsHeight()+1)
+	for _, row := range t.statsPanel() {
+		buf += "\x1b[K" + row + "\r\n"
+	}
+	// back to the prompt line
+	buf += fmt.Sprintf("\x1b[%d;1H\x1b[?25h", t.height)
+	fmt.Fprint(os.Stderr, buf)
+}
+
+// statsPanel returns the rows of the stats panel: the totals, then the
+// files with the most matches next to the most common capture group values
+func (t *Terminal) statsPanel() []string {
+	if !t.stats {
+		return nil
+	}
+
+	th := t.style.theme
+	rows := make([]string, statsRows+1)
+	var st *Stats
+	if t.result != nil {
+		st = t.result.stats
+	}
+	if st == nil {
+		rows[0] = th.prompt + "\u2500\u2500 \x1b[0m" + th.dim + "no matches yet\x1b[0m"
+		return rows
+	}
+
+	lines, files := 0, 0
+	for _, l := range t.result.matchLines {
+		lines += len(l)
+		if len(l) > 0 {
+			files++
+		}
+	}
+	rows[0] = fmt.Sprintf("%s\u2500\u2500 \x1b[0m%s%d\x1b[0m matches in %s%d\x1b[0m lines and %s%d\x1b[0m/%d files",
+		th.prompt, th.status, st.matches, th.status, lines, th.status, files, len(t.doc))
+	if st.distinct > 0 {
+		rows[0] += fmt.Sprintf(", %s%d\x1b[0m distinct values", th.status, st.distinct)
+	}
+
+	docs := make([]Count, 0, len(st.docMatches))
+	for d, n := range st.docMatches {
+		if n > 0 && d < len(t.doc) {
+			docs = append(docs, Count{key: t.doc[d].filename, n: n})
+		}
+	}
+	sortCounts(docs)
+
+	w := t.width / 2
+	for i := 0; i < statsRows; i++ {
+		left := ""
+		if i < len(docs) {
+			name := docs[i].key
+			if name == "" {
+				name = "(standard input)"
+			}
+			left = t.style.truncate(fmt.Sprintf("%7d  %s", docs[i].n, name), w-1)
+		}
+		rows[i+1] = th.file + left + "\x1b[0m" + strings.Repeat(" ", w-t.style.textWidth(left))
+
+		if i < len(st.top) {
+			c := st.top[i]
+			value := t.style.truncate(fmt.Sprintf("%7d  %s", c.n, c.key), w/2)
+			bar := (t.width - w - w/2 - 2) * c.n / st.top[0].n
+			if bar < 0 {
+				bar = 0
+			}
+			rows[i+1] += value + strings.Repeat(" ", w/2-t.style.textWidth(value)+1) +
+				th.match + strings.Repeat("\u2588", bar) + "\x1b[0m"
+		}
+	}
+
+	return rows
+}
+
+// textWidth returns the number of columns of text printed as is, where
+// each rune takes a column and tabs go to the next tab stop.  Unlike
+// width, it is for the panels rather than the lines of docs.
+func (st *Style) textWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n = st.advance(n, r)
+	}
+	return n
+}
+
+// advance returns the column after rune r printed at column n
+func (st *Style) advance(n int, r rune) int {
+	if r == '\t' {
+		return n + st.tabstop - n%st.tabstop
+	}
+	return n + 1
+}
+
+// truncate cuts s down to at most w columns as counted by textWidth
+func (st *Style) truncate(s string, w int) string {
+	n := 0
+	for i, r := range s {
+		if n = st.advance(n, r); n > w {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+var spinner = []string{"\u280b", "\u2819", "\u2839", "\u2838", "\u283c", "\u2834", "\u2826", "\u2827", "\u2807", "\u280f"}
+
+// progress returns the reading and searching state for the status line
+func (t *Terminal) progress() string {
+	th := t.style.theme
+	buf := "  " + th.dim
+
+	if t.reading {
+		buf += th.status + spinner[t.spin%len(spinner)] + "\x1b[0m" + th.dim + " " + humanBytes(t.numBytes)
+		if secs := time.Since(t.start).Seconds(); secs >= 1 {
+			buf += " " + humanBytes(int64(float64(t.numBytes)/secs)) + "/s"
+		}
+	} else {
+		buf += humanBytes(t.numBytes)
+	}
+
+	if searched, total := t.searchedChunks(), t.numChunks(); searched < total {
+		buf += fmt.Sprintf("  searching %d/%d", searched, total)
+	}
+
+	return buf + "\x1b[0m"
+}
+
+// searchedChunks returns the number of chunks the current query has
+// searched, which is all of them without a query
+func (t *Terminal) searchedChunks() int {
+	if t.result == nil || t.result.v < t.query.v || len(t.query.input) == 0 {
+		return t.numChunks()
+	}
+	return t.result.chunks
+}
+
+// numChunks returns the number of chunks read
+func (t *Terminal) numChunks() int {
+	n := 0
+	for _, d := range t.doc {
+		n += len(d.chunks)
+	}
+	return n
+}
+
+// humanBytes formats n like 12 B, 3.4 KB or 5.6 MB
+func humanBytes(n int64) string {
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+
+	f := float64(n)
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		f /= 1024
+		if f < 1024 || unit == "GB" {
+			return strconv.FormatFloat(f, 'f', 1, 64) + " " + unit
+		}
+	}
+	return ""
+}
+
+// RefreshPrompt refreshes just the prompt line
+func (t *Terminal) RefreshPrompt() {
+	t.mu.Lock()
+	if t.suspended {
+		t.mu.Unlock()
+		return
+	}
+	buf := "\x1b[G\x1b[F"
+
+	if t.doc != nil {
+		matchCount := t.numLines
+		if t.result != nil && t.result.matchLines != nil {
+			matchCount = 0
+			for _, x := range t.result.matchLines {
+				matchCount += len(x)
+			}
+		}
+		th := t.style.theme
+		buf += fmt.Sprintf("%s%d\x1b[0m%s/\x1b[0m%s%d\x1b[0m", th.status, matchCount, th.prompt, th.status, t.numLines)
+	}
+	if t.query.icase {
+		buf += "  " + t.style.theme.status + "(?i)\x1b[0m"
+	}
+	if t.query.invert {
+		buf += "  " + t.style.theme.status + "(-v)\x1b[0m"
+	}
+	if t.tail {
+		buf += "  " + t.style.theme.status + "(tail)\x1b[0m"
+	}
+	if t.longLines {
+		buf += "  " + t.style.theme.status + "(long)\x1b[0m"
+	}
+	if t.wrap {
+		buf += "  " + t.style.theme.status + "(wrap)\x1b[0m"
+	}
+	buf += t.progress()
+	buf += "\x1b[K\r\n"
+
+	if t.going {
+		label := "go to [file:]line"
+		if t.goFailed {
+			label = "no such location, " + label
+		}
+		buf += t.style.theme.prompt + "(" + label + "): \x1b[0m" + t.style.theme.input + t.goInput + "\x1b[K\x1b[0m"
+		fmt.Fprint(os.Stderr, buf)
+		t.mu.Unlock()
+		return
+	}
+
+	if t.searching {
+		label := "reverse-i-search"
+		if t.searchFailed {
+			label = "failed " + label
+		}
+		buf += t.style.theme.prompt + "(" + label + ")`\x1b[0m" + t.search + t.style.theme.prompt + "': \x1b[0m" + t.style.theme.input
+	} else {
+		buf += t.style.theme.prompt + "> \x1b[0m" + t.style.theme.input
+	}
+
+	if len(t.prompt) > 0 {
+		buf += t.prompt + " "
+	}
+
+	buf += t.query.input + "\x1b[K\x1b[0m"
+	if offset := t.input.Offset(); offset > 0 {
+		// set cursor
+		buf += "\x1b[" + strconv.Itoa(offset) + "D"
+	}
+
+	fmt.Fprint(os.Stderr, buf)
+	t.mu.Unlock()
+}
+
+// ClearBounds drops the result for the empty query of version v
+func (t *Terminal) ClearBounds(v int) {
+	t.mu.Lock()
+	t.result = nil
+	t.cleared = v
+	t.mu.Unlock()
+	t.Refresh()
+}
+
+func (t *Terminal) UpdateBounds(x *Result) {
+	t.mu.Lock()
+
+	if x.v <= t.cleared || (t.result != nil && x.v < t.result.v) {
+		// from a query that has been replaced since
+		t.mu.Unlock()
+		return
+	}
+	if t.result == nil || x.v > t.result.v {
+		t.displayed = false
+	}
+	t.result = x
+
+	refresh := false
+
+	// refresh the display if got a new version of result and got enough chunks
+	if !t.displayed {
+		n := len(t.result.matchIndex) - 1
+		numLines := 0
+
+		for d := 0; d < len(t.result.matchIndex); d++ {
+			if len(t.result.matchIndex[d].index) == len(t.doc[d].chunks) {
+				numLines += t.doc[d].numLines + t.files
+			} else {
+				numLines += t.files + len(t.result.matchIndex[d].index)*ChunkSize
+			}
+		}
+
+		if (len(t.result.matchIndex) == len(t.doc) && (n < 0 || len(t.result.matchIndex[n].index) == len(t.doc[n].chunks))) ||
+			numLines > t.posY+t.height {
+			t.displayed = true
+			refresh = true
+		}
+	}
+
+	t.mu.Unlock()
+	if refresh || t.hide || t.tail {
+		t.Refresh()
+	} else {
+		t.RefreshStats()
+	}
+	t.RefreshPrompt()
+}
+
+// UpdateWarnings shows the files that could not be read
+func (t *Terminal) UpdateWarnings(w []string) {
+	t.mu.Lock()
+	t.warnings = w
+	t.mu.Unlock()
+	t.Refresh()
 }
 
 func (t *Terminal) UpdatePrompt(s string) {
@@ -621,11 +2108,17 @@ func (t *Terminal) UpdateChunks(docs []*Doc, final bool) {
 
 	oldLines := t.numLines
 	t.numLines = 0
+	t.numBytes = 0
 	for _, d := range t.doc {
 		t.numLines += d.numLines
+		t.numBytes += d.bytes
+	}
+	if final {
+		t.reading = false
 	}
 
-	refresh = refresh || (oldLines < t.posX+t.height && t.numLines >= t.posX+t.height)
+	// new lines are in view or the view follows them
+	refresh = refresh || (t.numLines > oldLines && (t.tail || oldLines < t.posY+t.height))
 
 	t.mu.Unlock()
 
@@ -663,10 +2156,44 @@ func (t *Terminal) Init(files int) {
 	t.GetSize()
 
 	fmt.Fprint(os.Stderr, "\x1b[?1049h")
+	t.enableMouse()
+}
+
+// enableMouse turns on SGR mouse reporting of clicks and the wheel
+func (t *Terminal) enableMouse() {
+	if t.mouse {
+		fmt.Fprint(os.Stderr, "\x1b[?1000h\x1b[?1006h")
+	}
+}
+
+// Suspend restores the original terminal state so another program can use it
+func (t *Terminal) Suspend() {
+	t.mu.Lock()
+	t.suspended = true
+	t.mu.Unlock()
+
+	t.Close()
+}
+
+// Resume sets up raw mode and the alternate screen buffer again after Suspend
+func (t *Terminal) Resume() {
+	terminal.MakeRaw(t.fd())
+	t.GetSize()
+	fmt.Fprint(os.Stderr, "\x1b[?1049h")
+	t.enableMouse()
+
+	t.mu.Lock()
+	t.suspended = false
+	t.mu.Unlock()
+
+	t.Refresh()
 }
 
 // Close closes alternate screen buffer and restores original terminal state
 func (t *Terminal) Close() {
+	if t.mouse {
+		fmt.Fprint(os.Stderr, "\x1b[?1006l\x1b[?1000l")
+	}
 	fmt.Fprint(os.Stderr, "\x1b[?1049l")
 	err := terminal.Restore(t.fd(), t.origState)
 	if err != nil {
@@ -0,0 +1,297 @@
+package vre
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClip(t *testing.T) {
+	s := []byte("abécdef")
+	bounds := [][]int{{0, 2}, {2, 5, 1}, {6, 8}}
+
+	// cutting into the middle of é widens to the whole rune
+	res, nbounds := clip(s, bounds, 3, 6)
+	if string(res) != "écd" {
+		t.Errorf("Expected \"écd\", Got: %q", res)
+	}
+	expected := [][]int{{0, 3, 1}}
+	if !reflect.DeepEqual(nbounds, expected) {
+		t.Errorf("Expected %v, Got: %v", expected, nbounds)
+	}
+}
+
+func TestExpandTabsPastEnd(t *testing.T) {
+	st := Style{tabstop: 4}
+
+	// bounds beyond the line are cut off instead of left empty
+	line, bounds := st.expandTabs([]byte("a\tb"), [][]int{{0, 1}, {2, 5}, {7, 9}})
+	if line != "a   b" {
+		t.Errorf("Expected \"a   b\", Got: %q", line)
+	}
+	expected := [][]int{{0, 1}, {4, 5}}
+	if !reflect.DeepEqual(bounds, expected) {
+		t.Errorf("Expected %v, Got: %v", expected, bounds)
+	}
+}
+
+func TestGoTo(t *testing.T) {
+	lines := make([]string, 50)
+	for i := range lines {
+		lines[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		hide  bool
+		ok    bool
+		doc   int
+		line  int
+		posY  int
+	}{
+		{"line", "5", false, true, 0, 4, 5},
+		{"file and line", "b.txt:2", false, true, 1, 1, 53},
+		{"file", "b", false, true, 1, 0, 51},
+		{"past the end", "a:999", false, true, 0, 49, 50},
+		{"past the end of the last file", "b:999", false, true, 1, 49, 80},
+		{"no such file", "zz", false, false, 0, 0, 0},
+		{"line zero", "0", false, false, 0, 0, 0},
+		{"not a number", "a:x", false, false, 0, 0, 0},
+		{"hidden line", "a:5", true, true, 0, 9, 0},
+		{"hidden past the last match", "a:20", true, true, 0, 9, 0},
+		{"hidden past the last match of the last file", "b:20", true, true, 1, 2, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			term := &Terminal{
+				doc:     []*Doc{testDoc("a.txt", lines...), testDoc("b.txt", lines...)},
+				files:   1,
+				width:   80,
+				height:  24,
+				hide:    tc.hide,
+				match:   -1,
+				toggled: map[int]bool{},
+				result:  &Result{matchLines: [][]int{{1, 9}, {2}}},
+			}
+
+			if ok := term.goTo(tc.input); ok != tc.ok {
+				t.Fatalf("Expected %v, Got: %v", tc.ok, ok)
+			}
+			if !tc.ok {
+				if term.cursor != 0 || term.posY != 0 {
+					t.Errorf("Expected the view to stay, Got: cursor %d, posY %d", term.cursor, term.posY)
+				}
+				return
+			}
+
+			d, line, _ := term.cursorLine()
+			if d != tc.doc || line != tc.line {
+				t.Errorf("Expected %d:%d, Got: %d:%d", tc.doc, tc.line, d, line)
+			}
+			if term.posY != tc.posY {
+				t.Errorf("Expected posY %d, Got: %d", tc.posY, term.posY)
+			}
+		})
+	}
+	// a file without shown lines is not a location
+	term := &Terminal{
+		doc:     []*Doc{testDoc("a.txt", lines...), testDoc("b.txt", lines...)},
+		files:   1,
+		height:  24,
+		hide:    true,
+		match:   -1,
+		toggled: map[int]bool{},
+		result:  &Result{matchLines: [][]int{{1, 9}, {}}},
+	}
+	if term.goTo("b:1") {
+		t.Errorf("Expected no location in b, Got: %d", term.cursor)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	st := Style{tabstop: 4}
+
+	tests := []struct {
+		s        string
+		w        int
+		expected string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc"},
+		{"abc", 0, ""},
+		{"abc", -1, ""},
+		// tabs take up to the next tab stop
+		{"a\tbc", 4, "a\t"},
+		{"a\tbc", 3, "a"},
+		// runes take one column however many bytes they have
+		{"aébc", 2, "aé"},
+		{"aébc", 3, "aéb"},
+		{"日本語です", 3, "日本語"},
+	}
+
+	for _, tc := range tests {
+		if res := st.truncate(tc.s, tc.w); res != tc.expected {
+			t.Errorf("truncate(%q, %d): Expected %q, Got: %q", tc.s, tc.w, tc.expected, res)
+		}
+	}
+}
+
+func TestLineOffset(t *testing.T) {
+	term := &Terminal{longLines: true, style: Style{tabstop: 8}}
+
+	tests := []struct {
+		line     string
+		bounds   [][]int
+		expected int
+	}{
+		{"ab", [][]int{{0, 2}}, 0},
+		{"0123456789abc", [][]int{{10, 12}}, 8},
+		// the tabs before the match push it out of view
+		{"\t\tab", [][]int{{2, 4}}, 14},
+		{"\tab", [][]int{{1, 3}}, 0},
+	}
+
+	for _, test := range tests {
+		if x := term.lineOffset([]byte(test.line), test.bounds, 10); x != test.expected {
+			t.Errorf("Line: %q, Expected %d, Got: %d", test.line, test.expected, x)
+		}
+	}
+}
+
+// wrapTerminal returns a terminal in wrap mode with 10 columns for lines
+// and a view of 5 rows, showing lines that wrap into 1, 3, 1, 5 (cut
+// down from 6), 1, 1, 2 and 1 rows
+func wrapTerminal() *Terminal {
+	lines := []string{
+		"a",
+		strings.Repeat("b", 25),
+		"c",
+		strings.Repeat("d", 60),
+		"e",
+		"f",
+		strings.Repeat("g", 15),
+		"h",
+	}
+	return &Terminal{
+		doc:     []*Doc{testDoc("", lines...)},
+		width:   10 + gutterWidth,
+		height:  7,
+		wrap:    true,
+		match:   -1,
+		toggled: map[int]bool{},
+		style:   Style{tabstop: 8},
+	}
+}
+
+func TestFitRows(t *testing.T) {
+	tests := []struct {
+		row      int
+		dir      int
+		expected int
+	}{
+		{0, 1, 3},
+		{3, 1, 1},
+		{4, 1, 4},
+		{2, -1, 3},
+		{3, -1, 1},
+		{7, -1, 4},
+		{8, 1, 1},
+	}
+
+	term := wrapTerminal()
+	for _, test := range tests {
+		if n := term.fitRows(test.row, test.dir); n != test.expected {
+			t.Errorf("Row: %d, Dir: %d, Expected %d, Got: %d", test.row, test.dir, test.expected, n)
+		}
+	}
+}
+
+func TestWrapPaging(t *testing.T) {
+	tests := []struct {
+		name           string
+		posY           int
+		cursor         int
+		move           func(t *Terminal)
+		expectedPosY   int
+		expectedCursor int
+	}{
+		// the next page starts at the line that did not fit
+		{"page down", 0, 0, func(t *Terminal) { t.scroll(t.pageRows(1)) }, 3, 3},
+		{"page down from a tall line", 3, 3, func(t *Terminal) { t.scroll(t.pageRows(1)) }, 4, 4},
+		{"page down past the end", 4, 4, func(t *Terminal) { t.scroll(t.pageRows(1)) }, 4, 7},
+		// the cursor stays in the new view instead of pulling it back
+		{"page up to a tall line", 4, 7, func(t *Terminal) { t.scroll(-t.pageRows(-1)) }, 3, 3},
+		{"page up", 3, 3, func(t *Terminal) { t.scroll(-t.pageRows(-1)) }, 0, 0},
+		{"page up keeps the cursor", 3, 3, func(t *Terminal) { t.scroll(-1) }, 2, 2},
+		// the whole cursor line is brought into view
+		{"down onto a tall line", 0, 2, func(t *Terminal) { t.moveCursor(1) }, 3, 3},
+		{"down onto a wrapped line", 0, 0, func(t *Terminal) { t.moveCursor(1) }, 0, 1},
+		{"up onto a tall line", 4, 4, func(t *Terminal) { t.moveCursor(-1) }, 3, 3},
+	}
+
+	for _, test := range tests {
+		term := wrapTerminal()
+		term.posY, term.cursor = test.posY, test.cursor
+		test.move(term)
+		if term.posY != test.expectedPosY || term.cursor != test.expectedCursor {
+			t.Errorf("%s: Expected posY %d and cursor %d, Got: %d and %d", test.name, test.expectedPosY, test.expectedCursor, term.posY, term.cursor)
+		}
+	}
+}
+
+func TestJumpMatch(t *testing.T) {
+	docs := []*Doc{testDoc("a", "x", "yy", "x x"), testDoc("b", "z"), testDoc("c", "x")}
+	o := runQuery(t, "/x/g", docs...)
+
+	tests := []struct {
+		name          string
+		doc           int
+		line          int // -1 for the file header
+		match         int
+		dir           int
+		summary       bool
+		loaded        int // number of docs searched so far
+		expectedDoc   int
+		expectedLine  int
+		expectedMatch int
+	}{
+		{"cursor line first", 0, 0, -1, 1, false, 3, 0, 0, 0},
+		{"within a line", 0, 2, 0, 1, false, 3, 0, 2, 1},
+		{"next doc", 0, 2, 1, 1, false, 3, 2, 0, 0},
+		{"wrap around the end", 2, 0, 0, 1, false, 3, 0, 0, 0},
+		{"wrap around the start", 0, 0, 0, -1, false, 3, 2, 0, 0},
+		{"previous doc", 2, 0, 0, -1, false, 3, 0, 2, 1},
+		{"back within a line", 0, 2, 1, -1, false, 3, 0, 2, 0},
+		{"unfold a folded doc", 0, -1, -1, 1, true, 3, 0, 0, 0},
+		// the cursor doc has not been searched yet
+		{"down while loading", 2, 0, -1, 1, false, 1, 0, 0, 0},
+		{"up while loading", 2, 0, -1, -1, false, 1, 0, 2, 1},
+	}
+
+	for _, test := range tests {
+		term := &Terminal{
+			doc:     docs,
+			files:   1,
+			width:   80,
+			height:  24,
+			summary: test.summary,
+			toggled: map[int]bool{},
+			result:  &Result{matchLines: o.matchLines[:test.loaded], matchIndex: o.matchIndex[:test.loaded]},
+		}
+		if test.line < 0 {
+			term.cursor = term.rowOf(test.doc, 0) - 1
+		} else {
+			term.cursor = term.rowOf(test.doc, test.line)
+		}
+		term.match = test.match
+
+		term.jumpMatch(test.dir)
+		d, line, _ := term.cursorLine()
+		if d != test.expectedDoc || line != test.expectedLine || term.match != test.expectedMatch {
+			t.Errorf("%s: Expected %d:%d match %d, Got: %d:%d match %d", test.name, test.expectedDoc, test.expectedLine, test.expectedMatch, d, line, term.match)
+		}
+	}
+}